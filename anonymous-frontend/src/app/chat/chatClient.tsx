@@ -3,11 +3,18 @@
 
 import AddContactModal from '@/components/AddContactModal';
 import CommandDropdown, { COMMANDS } from '@/components/CommandDropdown';
-import StockChart, { isChartData, parseChartData } from '@/components/StockChart';
+import CompareChart, { CompareData } from '@/components/CompareChart';
+import StockChart, { ChartData } from '@/components/StockChart';
 import UserProfile from '@/components/UserProfile';
 import Link from 'next/link';
 import { KeyboardEvent, useEffect, useReducer, useRef, useState } from 'react';
 
+interface Payload {
+	kind: 'quote' | 'chart' | 'news' | 'table' | 'compare';
+	version: number;
+	data: unknown;
+}
+
 interface Message {
 	type: 'chat' | 'history' | 'bot' | 'notification';
 	from: string;
@@ -15,6 +22,7 @@ interface Message {
 	body: string;
 	messageid: string;
 	count?: number;
+	payload?: Payload;
 }
 
 type Action =
@@ -451,11 +459,10 @@ export default function ChatClient({ user, token }: { user: string, token: strin
 											: 'bg-[#44475a] text-[#f8f8f2] rounded-bl-none border-2 border-[#bd93f9]'
 											}`}
 									>
-										{m.type === 'bot' && isChartData(m.body) ? (
-											(() => {
-												const chart = parseChartData(m.body);
-												return chart ? <StockChart data={chart} /> : <span>Failed to load chart</span>;
-											})()
+										{m.payload?.kind === 'chart' ? (
+											<StockChart data={m.payload.data as ChartData} />
+										) : m.payload?.kind === 'compare' ? (
+											<CompareChart data={m.payload.data as CompareData} />
 										) : m.type === 'bot' ? (
 											<div className="whitespace-pre-line">
 												{m.body.split('\n').map((line, index) => (
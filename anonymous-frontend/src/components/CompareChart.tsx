@@ -0,0 +1,80 @@
+'use client';
+
+export interface CompareData {
+	period: string;
+	series: { symbol: string; points: { date: string; close: number }[] }[];
+}
+
+const COLORS = ['#8be9fd', '#ff79c6', '#f1fa8c', '#50fa7b', '#ffb86c'];
+
+// Every series is rebased to 100 at its first point, so one shared scale
+// compares their performance directly.
+export default function CompareChart({ data }: { data: CompareData }) {
+	const series = (data.series ?? []).filter(s => s.points && s.points.length > 1);
+	if (series.length === 0) return null;
+
+	const closes = series.flatMap(s => s.points.map(p => p.close));
+	const min = Math.min(...closes);
+	const max = Math.max(...closes);
+	const range = max - min || 1;
+
+	const w = 280;
+	const h = 120;
+	const padTop = 8;
+	const padBot = 20;
+	const chartH = h - padTop - padBot;
+	const chartW = w;
+	const baseY = padTop + chartH - ((100 - min) / range) * chartH;
+	const first = series[0].points;
+
+	return (
+		<div>
+			<div className="flex flex-wrap items-baseline gap-2 mb-1">
+				{series.map((s, i) => {
+					const change = s.points[s.points.length - 1].close - 100;
+					return (
+						<span key={s.symbol} className="text-sm font-bold" style={{ color: COLORS[i % COLORS.length] }}>
+							{s.symbol}{' '}
+							<span className="text-xs font-mono">
+								{change >= 0 ? '+' : ''}{change.toFixed(2)}%
+							</span>
+						</span>
+					);
+				})}
+				<span className="text-xs text-[#6272a4]">{data.period}</span>
+			</div>
+			<svg viewBox={`0 0 ${w} ${h}`} width={w} height={h} className="block">
+				{/* Starting value */}
+				{baseY >= padTop && baseY <= padTop + chartH && (
+					<line x1={0} x2={chartW} y1={baseY} y2={baseY}
+						stroke="#6272a4" strokeWidth="0.5" strokeDasharray="3,3" opacity="0.6" />
+				)}
+
+				{series.map((s, i) => (
+					<polyline
+						key={s.symbol}
+						points={s.points
+							.map((p, j) => {
+								const x = (j / (s.points.length - 1)) * chartW;
+								const y = padTop + chartH - ((p.close - min) / range) * chartH;
+								return `${x},${y}`;
+							})
+							.join(' ')}
+						fill="none"
+						stroke={COLORS[i % COLORS.length]}
+						strokeWidth="1.5"
+						strokeLinejoin="round"
+					/>
+				))}
+
+				{/* Date labels */}
+				<text x={0} y={h - 4} fill="#6272a4" fontSize="7" fontFamily="monospace">
+					{first[0].date}
+				</text>
+				<text x={chartW} y={h - 4} fill="#6272a4" fontSize="7" fontFamily="monospace" textAnchor="end">
+					{first[first.length - 1].date}
+				</text>
+			</svg>
+		</div>
+	);
+}
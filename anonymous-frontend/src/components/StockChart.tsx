@@ -1,23 +1,11 @@
 'use client';
 
-interface ChartData {
+export interface ChartData {
 	symbol: string;
 	period: string;
 	points: { date: string; close: number }[];
 }
 
-export function isChartData(body: string): boolean {
-	return body.startsWith('CHART_DATA:');
-}
-
-export function parseChartData(body: string): ChartData | null {
-	try {
-		return JSON.parse(body.slice('CHART_DATA:'.length));
-	} catch {
-		return null;
-	}
-}
-
 export default function StockChart({ data }: { data: ChartData }) {
 	const { symbol, period, points } = data;
 	if (!points || points.length === 0) return null;
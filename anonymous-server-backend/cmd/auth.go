@@ -3,6 +3,7 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -87,7 +88,7 @@ func HandleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 	// Existing user: generate JWT and set cookie
 	// Construct services.User for token generation
 	svcUser := services.User{Username: userDoc.Username}
-	tokenStr, err := services.GenerateJWTToken(svcUser)
+	tokenStr, err := services.GenerateJWTToken(ctx, svcUser)
 	if err != nil {
 		http.Error(w, "Token generation error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -109,6 +110,10 @@ func HandleExternalRegister(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 	user, err := services.CreateExternalUser(ctx, p.GoogleID, p.Email, p.Username, p.Password)
+	if errors.Is(err, services.ErrReservedUsername) {
+		http.Error(w, "Failed to create user: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -116,7 +121,7 @@ func HandleExternalRegister(w http.ResponseWriter, r *http.Request) {
 
 	// generate JWT & set cookie
 	svcUser := services.User{Username: user.Username}
-	tok, err := services.GenerateJWTToken(svcUser)
+	tok, err := services.GenerateJWTToken(ctx, svcUser)
 	if err != nil {
 		http.Error(w, "Token generation error: "+err.Error(), http.StatusInternalServerError)
 		return
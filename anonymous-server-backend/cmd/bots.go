@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+	"github.com/zelshahawy/Anonymous_backend/services"
+)
+
+const (
+	// botWorkers is how many bot commands run concurrently across all users.
+	botWorkers = 8
+	// botQueueSize is how many bot commands may wait for a worker.
+	botQueueSize = 64
+	// maxBotJobsPerUser caps one user's queued and running bot commands.
+	maxBotJobsPerUser = 2
+
+	botThinkingBody = "🤔 Bot is thinking..."
+)
+
+var (
+	errBotUserBusy = failFrame(errCodeBotBusy, errors.New("too many bot commands in flight, wait for a reply"))
+	errBotPoolFull = failFrame(errCodeBotBusy, errors.New("the bot is busy, try again shortly"))
+)
+
+// isBotCommand reports whether a chat body should be handed to the bot.
+func isBotCommand(body string) bool {
+	return strings.HasPrefix(strings.TrimSpace(body), "/")
+}
+
+// botJob is one chat message waiting for bot command processing.
+type botJob struct {
+	msg        hub.Message
+	recipients []string
+	pendingID  string
+}
+
+// botPool runs bot commands on a bounded set of workers. Jobs run on the
+// pool's context rather than their socket's, so a command whose sender
+// disconnects, including during shutdown, still saves its reply.
+type botPool struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	jobs    chan botJob
+	wg      sync.WaitGroup // queued and running jobs
+	mu      sync.Mutex
+	perUser map[string]int
+}
+
+var bots = newBotPool(botWorkers, botQueueSize)
+
+func newBotPool(workers, queue int) *botPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &botPool{
+		ctx:     ctx,
+		cancel:  cancel,
+		jobs:    make(chan botJob, queue),
+		perUser: make(map[string]int),
+	}
+	for range workers {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues msg for bot processing and shows the conversation a
+// placeholder until the reply lands.
+func (p *botPool) Submit(msg *hub.Message, recipients []string) error {
+	p.mu.Lock()
+	if p.perUser[msg.From] >= maxBotJobsPerUser {
+		p.mu.Unlock()
+		return errBotUserBusy
+	}
+
+	job := botJob{
+		msg:        *msg,
+		recipients: recipients,
+		pendingID:  hub.GenerateMessageID(),
+	}
+	select {
+	case p.jobs <- job:
+		p.perUser[msg.From]++
+		p.wg.Add(1)
+		p.mu.Unlock()
+	default:
+		p.mu.Unlock()
+		return errBotPoolFull
+	}
+
+	hub.GlobalHub.SendMany(recipients, &hub.Message{
+		Type:      "bot_pending",
+		Messageid: job.pendingID,
+		From:      msg.From,
+		To:        msg.To,
+		Body:      botThinkingBody,
+	})
+	return nil
+}
+
+// Wait blocks until every queued and running job has finished. If ctx is done
+// first, the remaining jobs are cancelled.
+func (p *botPool) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+func (p *botPool) work() {
+	for job := range p.jobs {
+		p.run(job)
+	}
+}
+
+func (p *botPool) run(job botJob) {
+	defer func() {
+		p.mu.Lock()
+		if p.perUser[job.msg.From]--; p.perUser[job.msg.From] <= 0 {
+			delete(p.perUser, job.msg.From)
+		}
+		p.mu.Unlock()
+		p.wg.Done()
+	}()
+
+	if p.ctx.Err() == nil && processBotCommands(p.ctx, &job.msg, job.recipients, job.pendingID) {
+		return
+	}
+
+	// Nothing replaced the placeholder, so retract it.
+	hub.GlobalHub.SendMany(job.recipients, &hub.Message{
+		Type:      "bot_pending",
+		Messageid: job.pendingID,
+		From:      job.msg.From,
+		To:        job.msg.To,
+		Deleted:   true,
+	})
+}
+
+// replyBotBusy tells the sender that the bot command in msg was not run. The
+// chat message itself was already acknowledged, so the error frame names it by
+// message ID and leaves out the nonce and correlation ID.
+func replyBotBusy(c *hub.Client, msg *hub.Message, err error) {
+	replyError(c, &hub.Message{Messageid: msg.Messageid, To: msg.To}, err)
+}
+
+// WaitForBots blocks until in-flight bot commands finish, cancelling any still
+// running when ctx is done.
+func WaitForBots(ctx context.Context) error {
+	return bots.Wait(ctx)
+}
+
+// processBotCommands handles all bot commands and sends responses to every
+// participant of the conversation. The first response reuses pendingID so it
+// replaces the "thinking" placeholder. It reports whether that happened.
+func processBotCommands(ctx context.Context, msg *hub.Message, recipients []string, pendingID string) bool {
+	log.Printf("Processing bot commands for message: %s", msg.Body)
+
+	allResponses := services.Commands.Dispatch(ctx, msg)
+
+	log.Printf("Total bot responses: %d", len(allResponses))
+
+	if ctx.Err() != nil {
+		log.Printf("Bot commands for %s cancelled: %v", msg.From, ctx.Err())
+		return false
+	}
+
+	for i, bot := range allResponses {
+		log.Printf("Processing bot response %d: %s", i+1, bot.Body)
+
+		id := hub.GenerateMessageID()
+		if i == 0 {
+			id = pendingID
+		}
+		botMsg := hub.Message{
+			Type:      "bot",
+			Messageid: id,
+			From:      msg.From,
+			To:        msg.To,
+			Body:      bot.Body,
+			Payload:   bot.Payload,
+		}
+
+		if err := services.SaveMessage(ctx, &services.MessageDoc{
+			MsgID:    botMsg.Messageid,
+			From:     botMsg.From,
+			To:       botMsg.To,
+			Body:     botMsg.Body,
+			Type:     botMsg.Type,
+			Payload:  botMsg.Payload,
+			Notified: !services.IsRoomID(botMsg.To) && hub.GlobalHub.IsUserConnected(botMsg.To),
+		}); err != nil {
+			log.Printf("failed to save bot message %s: %v", botMsg.Messageid, err)
+		} else {
+			log.Printf("Successfully saved bot message %s", botMsg.Messageid)
+		}
+
+		hub.GlobalHub.SendMany(recipients, &botMsg)
+		log.Printf("Sent bot message to users %v", recipients)
+	}
+	return len(allResponses) > 0
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/zelshahawy/Anonymous_backend/services"
+)
+
+// commandInfo is how a bot command is described to the frontend's command dropdown.
+type commandInfo struct {
+	// Command is the text inserted when the command is picked, e.g. "/stocks ".
+	Command     string                `json:"command"`
+	Usage       string                `json:"usage"`
+	Description string                `json:"description"`
+	Aliases     []string              `json:"aliases,omitempty"`
+	Args        []services.CommandArg `json:"args,omitempty"`
+	Example     string                `json:"example,omitempty"`
+}
+
+// CommandsHandler lists every bot command, including /help.
+func CommandsHandler(w http.ResponseWriter, r *http.Request) {
+	cmds := services.Commands.Commands()
+	out := make([]commandInfo, 0, len(cmds)+1)
+	out = append(out, commandInfo{
+		Command:     "/help",
+		Usage:       "/help [COMMAND]",
+		Description: "List bot commands or explain one",
+		Args:        []services.CommandArg{{Name: "COMMAND"}},
+	})
+	for i := range cmds {
+		c := &cmds[i]
+		insert := "/" + c.Name
+		if len(c.Args) > 0 {
+			insert += " "
+		}
+		out = append(out, commandInfo{
+			Command:     insert,
+			Usage:       c.Usage(),
+			Description: c.Description,
+			Aliases:     c.Aliases,
+			Args:        c.Args,
+			Example:     c.Example,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zelshahawy/Anonymous_backend/services"
+)
+
+// HealthHandler reports server health for load balancers and monitoring.
+// The server stays "ok" while the finance service is failing, but reports
+// "degraded" with the circuit breaker state so bot outages are visible.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	finance := services.FinanceAPIHealth()
+	status := "ok"
+	if finance.State != services.BreakerClosed {
+		status = "degraded"
+	}
+
+	response := map[string]any{
+		"status":  status,
+		"time":    time.Now().Format(time.RFC3339),
+		"finance": finance,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -1,11 +1,12 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/zelshahawy/Anonymous_backend/config"
 	"github.com/zelshahawy/Anonymous_backend/services"
 )
@@ -14,22 +15,47 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	frontend := config.Config().GetString("frontend_url")
 
 	if cookie, err := r.Cookie("auth_token"); err == nil {
-		token, err := jwt.ParseWithClaims(cookie.Value, &jwt.StandardClaims{}, func(t *jwt.Token) (any, error) {
-			return services.SecretKey, nil
-		})
-		if err == nil {
-			if claims, ok := token.Claims.(*jwt.StandardClaims); ok && token.Valid {
-				services.RevokeJTI(claims.Id, time.Unix(claims.ExpiresAt, 0))
-				user := claims.Subject
-				if user == "testuser1" || user == "testuser2" {
-					if err := services.DeleteUserData(user); err != nil {
-						log.Printf("failed to delete data for %s: %v", user, err)
-					}
+		if claims, err := services.Logout(r.Context(), cookie.Value); err != nil {
+			log.Printf("logout: %v", err)
+		} else {
+			user := claims.Subject
+			if user == "testuser1" || user == "testuser2" {
+				if err := services.DeleteUserData(user); err != nil {
+					log.Printf("failed to delete data for %s: %v", user, err)
 				}
 			}
 		}
 	}
 
+	clearSessionCookie(w)
+	http.Redirect(w, r, frontend+"/", http.StatusSeeOther)
+}
+
+// LogoutAllHandler revokes every token issued to the current user, signing
+// them out of all browsers and devices.
+func LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := services.UserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := services.RevokeUserTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("failed to revoke tokens for %s: %v", userID, err)
+		http.Error(w, "Failed to log out everywhere", http.StatusInternalServerError)
+		return
+	}
+
+	clearSessionCookie(w)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked}); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// clearSessionCookie expires the auth_token cookie.
+func clearSessionCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "auth_token",
 		Value:    "",
@@ -38,6 +64,4 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 	})
-
-	http.Redirect(w, r, frontend+"/", http.StatusSeeOther)
 }
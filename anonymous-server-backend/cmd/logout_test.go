@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Tokens that fail verification never reach the token store, so these run
+// without Mongo.
+func TestLogoutHandlerClearsCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string // empty means no cookie
+	}{
+		{name: "no cookie"},
+		{name: "bad cookie", cookie: "garbage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "auth_token", Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			LogoutHandler(rec, req)
+
+			if rec.Code != http.StatusSeeOther {
+				t.Errorf("status = %d; want %d", rec.Code, http.StatusSeeOther)
+			}
+			var cleared bool
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == "auth_token" && c.Value == "" && !c.Expires.After(time.Unix(0, 0)) {
+					cleared = true
+				}
+			}
+			if !cleared {
+				t.Errorf("auth_token not cleared; Set-Cookie = %q", rec.Header().Values("Set-Cookie"))
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+	"github.com/zelshahawy/Anonymous_backend/services"
+)
+
+// replayBatchSize is how many missed messages are loaded per query when a
+// session resumes.
+const replayBatchSize = sendBufferSize / 4
+
+// replayMissedMessages writes every persisted message the user missed since
+// the given message ID straight to the socket, in order and in batches, then
+// a "replay_end" frame. It must run before writePump starts so writes are not
+// concurrent. The returned IDs were replayed and should be skipped if also
+// queued live.
+func replayMissedMessages(ctx context.Context, c *hub.Client, since string) map[string]bool {
+	replayed := map[string]bool{}
+
+	end := &hub.Message{
+		Type:  "replay_end",
+		To:    c.UserID,
+		After: since,
+	}
+	for {
+		missed, hasMore, err := services.LoadMessagesSince(ctx, c.UserID, end.After, replayBatchSize)
+		if err != nil {
+			log.Printf("failed loading missed messages for %s since %s: %v", c.UserID, end.After, err)
+			break
+		}
+		for i := range missed {
+			if err := c.Conn.WriteJSON(storedMessage(&missed[i])); err != nil {
+				log.Printf("failed replaying to %s: %v", c.UserID, err)
+				return replayed
+			}
+			replayed[missed[i].MsgID] = true
+			end.After = missed[i].MsgID
+			end.Count++
+		}
+		if !hasMore {
+			break
+		}
+	}
+	if err := c.Conn.WriteJSON(end); err != nil {
+		log.Printf("failed replaying to %s: %v", c.UserID, err)
+		return replayed
+	}
+
+	// Replayed messages supersede the coarse unread notifications.
+	if err := services.MarkUnreadChatMessagesNotified(ctx, c.UserID); err != nil {
+		log.Printf("failed marking unread messages notified for %s: %v", c.UserID, err)
+	}
+	return replayed
+}
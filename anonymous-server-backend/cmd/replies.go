@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+	"github.com/zelshahawy/Anonymous_backend/services"
+)
+
+// Machine-readable codes carried by "error" frames.
+const (
+	errCodeValidation            = "validation_failed"
+	errCodePersistence           = "persistence_failed"
+	errCodeRateLimited           = "rate_limited"
+	errCodeUnauthorizedRecipient = "unauthorized_recipient"
+	errCodeForbidden             = "forbidden"
+	errCodeNotFound              = "not_found"
+	errCodeUnknownType           = "unknown_type"
+	errCodeBotBusy               = "bot_busy"
+)
+
+// frameError is a frame failure with the code reported back to the client.
+type frameError struct {
+	code string
+	err  error
+}
+
+func (e *frameError) Error() string { return e.code + ": " + e.err.Error() }
+
+func (e *frameError) Unwrap() error { return e.err }
+
+// failFrame wraps err with the error code the client should see.
+func failFrame(code string, err error) error {
+	return &frameError{code: code, err: err}
+}
+
+// errorCode maps a handler error to the code sent to the client.
+func errorCode(err error) string {
+	var fe *frameError
+	switch {
+	case errors.As(err, &fe):
+		return fe.code
+	case errors.Is(err, services.ErrEmptyMessage),
+		errors.Is(err, services.ErrRoomNameRequired):
+		return errCodeValidation
+	case errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrRoomNotFound),
+		errors.Is(err, services.ErrNotRoomMember):
+		return errCodeUnauthorizedRecipient
+	case errors.Is(err, services.ErrNotRecipient),
+		errors.Is(err, services.ErrNotMessageAuthor),
+		errors.Is(err, services.ErrMessageDeleted):
+		return errCodeForbidden
+	case errors.Is(err, services.ErrMessageNotFound):
+		return errCodeNotFound
+	default:
+		return errCodePersistence
+	}
+}
+
+// ackMessage confirms a client frame. msgID is the server-assigned message ID.
+func ackMessage(req *hub.Message, msgID string) *hub.Message {
+	return &hub.Message{
+		Type:          "ack",
+		Messageid:     msgID,
+		To:            req.To,
+		Nonce:         req.Nonce,
+		CorrelationID: req.CorrelationID,
+	}
+}
+
+// replyError reports a failed frame to the client that sent it.
+func replyError(c *hub.Client, req *hub.Message, err error) {
+	detail := err.Error()
+	var fe *frameError
+	if errors.As(err, &fe) {
+		detail = fe.err.Error()
+	}
+	c.Deliver(&hub.Message{
+		Type:          "error",
+		Messageid:     req.Messageid,
+		To:            req.To,
+		Body:          detail,
+		Nonce:         req.Nonce,
+		CorrelationID: req.CorrelationID,
+		Code:          errorCode(err),
+	})
+}
+
+// frameLimiter is a token bucket limiting how fast one socket may send frames.
+type frameLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newFrameLimiter(rate, burst int) *frameLimiter {
+	return &frameLimiter{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow reports whether another frame may be processed now.
+func (l *frameLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
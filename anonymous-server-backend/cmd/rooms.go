@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+	"github.com/zelshahawy/Anonymous_backend/services"
+)
+
+// conversationRecipients returns the users a message from userID to "to" should
+// be delivered to. Rooms resolve to their members; anything else is a 1:1 chat.
+func conversationRecipients(ctx context.Context, userID, to string) ([]string, error) {
+	if !services.IsRoomID(to) {
+		return []string{userID, to}, nil
+	}
+	room, err := services.FindRoomForMember(ctx, to, userID)
+	if err != nil {
+		return nil, err
+	}
+	return room.MemberIDs(), nil
+}
+
+// sendRecipients is conversationRecipients for a frame userID is sending, which
+// additionally requires a 1:1 recipient to be a registered user.
+func sendRecipients(ctx context.Context, userID, to string) ([]string, error) {
+	if !services.IsRoomID(to) {
+		if _, err := services.FindUserByUsername(ctx, to); err != nil {
+			return nil, err
+		}
+	}
+	return conversationRecipients(ctx, userID, to)
+}
+
+// roomMessage builds the "room" frame describing a room's current state.
+func roomMessage(room *services.RoomDoc) *hub.Message {
+	return &hub.Message{
+		Type:      "room",
+		Messageid: hub.GenerateMessageID(),
+		From:      room.CreatedBy,
+		To:        room.RoomID,
+		Body:      room.Name,
+		Members:   room.MemberIDs(),
+	}
+}
+
+// handleRoomFrame processes room management frames sent by a client.
+func handleRoomFrame(ctx context.Context, c *hub.Client, msg *hub.Message) error {
+	switch msg.Type {
+	case "room_create":
+		room, err := services.CreateRoom(ctx, msg.Body, c.UserID, msg.Members)
+		if err != nil {
+			return err
+		}
+		msg.To = room.RoomID
+		hub.GlobalHub.SendMany(room.MemberIDs(), roomMessage(room))
+
+	case "room_invite":
+		if _, err := services.FindRoomForMember(ctx, msg.To, c.UserID); err != nil {
+			return err
+		}
+		if err := services.AddRoomMembers(ctx, msg.To, msg.Members); err != nil {
+			return err
+		}
+		room, err := services.FindRoom(ctx, msg.To)
+		if err != nil {
+			return err
+		}
+		hub.GlobalHub.SendMany(room.MemberIDs(), roomMessage(room))
+
+	case "room_leave":
+		if _, err := services.FindRoomForMember(ctx, msg.To, c.UserID); err != nil {
+			return err
+		}
+		if err := services.RemoveRoomMember(ctx, msg.To, c.UserID); err != nil {
+			return err
+		}
+		hub.GlobalHub.Send(c.UserID, &hub.Message{
+			Type:      "room_leave",
+			Messageid: hub.GenerateMessageID(),
+			From:      c.UserID,
+			To:        msg.To,
+		})
+		room, err := services.FindRoom(ctx, msg.To)
+		if err != nil {
+			return err
+		}
+		hub.GlobalHub.SendMany(room.MemberIDs(), roomMessage(room))
+
+	case "rooms":
+		rooms, err := services.LoadUserRooms(ctx, c.UserID)
+		if err != nil {
+			return err
+		}
+		for i := range rooms {
+			c.Deliver(roomMessage(&rooms[i]))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+// HubStatsHandler reports connection and backpressure counters for the hub.
+func HubStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(hub.GlobalHub.Stats()); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
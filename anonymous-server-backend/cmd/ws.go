@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -14,8 +17,20 @@ import (
 )
 
 const (
+	maxNonceLength = 128
+
+	// frameRate and frameBurst bound how many frames a single socket may send.
+	frameRate  = 5
+	frameBurst = 20
+
 	pongWait   = 60 * time.Second
 	pingPeriod = 30 * time.Second
+
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 100
+
+	// sendBufferSize is how many outgoing frames a client may have queued.
+	sendBufferSize = 256
 )
 
 var upgrader = websocket.Upgrader{
@@ -37,17 +52,13 @@ func WsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized: missing token", http.StatusUnauthorized)
 		return
 	}
-	claim, err := services.ValidateToken(token)
+	claim, err := services.VerifyToken(r.Context(), token)
 	if err != nil {
 		log.Printf("invalid token: %v", err)
 		http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
 		return
 	}
 	userID := claim.Subject
-	if userID == "" {
-		http.Error(w, "Unauthorized: empty user ID", http.StatusUnauthorized)
-		return
-	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -58,13 +69,21 @@ func WsHandler(w http.ResponseWriter, r *http.Request) {
 	client := &hub.Client{
 		Conn:   conn,
 		UserID: userID,
-		Send:   make(chan *hub.Message, 256),
+		Send:   make(chan *hub.Message, sendBufferSize),
 	}
 	hub.GlobalHub.Register(client)
 
-	ctx := r.Context()
-	go writePump(client)
-	sendOfflineNotifications(ctx, client)
+	// Cancelled when the socket closes.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if since := r.URL.Query().Get("since"); hub.IsMessageID(since) {
+		// Registered first so live messages queue up in Send while we replay.
+		replayed := replayMissedMessages(ctx, client, since)
+		go writePump(client, replayed)
+	} else {
+		go writePump(client, nil)
+		sendOfflineNotifications(ctx, client)
+	}
 	readPump(ctx, client)
 }
 
@@ -95,121 +114,309 @@ func sendOfflineNotifications(ctx context.Context, c *hub.Client) {
 	}
 }
 
-// processBotCommands handles all bot commands and sends responses
-func processBotCommands(ctx context.Context, msg *hub.Message) {
-	log.Printf("Processing bot commands for message: %s", msg.Body)
-
-	var allResponses []services.BotResponse
+func readPump(ctx context.Context, c *hub.Client) {
+	defer func() {
+		hub.GlobalHub.Unregister(c)
+		c.Conn.Close()
+	}()
 
-	// Collect responses from all command handlers
-	allResponses = append(allResponses, services.HandleStockCommand(msg)...)
-	allResponses = append(allResponses, services.HandleTopMoversCommand(msg)...)
-	allResponses = append(allResponses, services.HandleNewsCommand(msg)...)
-	allResponses = append(allResponses, services.HandleCryptoCommand(msg)...)
-	allResponses = append(allResponses, services.HandleIndicesCommand(msg)...)
-	allResponses = append(allResponses, services.HandleTrendingCommand(msg)...)
-	allResponses = append(allResponses, services.HandleChartCommand(msg)...)
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
 
-	log.Printf("Total bot responses: %d", len(allResponses))
+	limiter := newFrameLimiter(frameRate, frameBurst)
+	for {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		// A field of the wrong type fails the frame, not the socket; the
+		// fields that did decode still correlate the error reply.
+		var msg hub.Message
+		decodeErr := json.Unmarshal(data, &msg)
 
-	for i, bot := range allResponses {
-		log.Printf("Processing bot response %d: %s", i+1, bot.Body)
+		if !limiter.Allow() {
+			replyError(c, &msg, failFrame(errCodeRateLimited, errors.New("too many frames, slow down")))
+			continue
+		}
+		if decodeErr != nil {
+			replyError(c, &msg, failFrame(errCodeValidation, fmt.Errorf("malformed frame: %v", decodeErr)))
+			continue
+		}
 
-		botMsg := hub.Message{
-			Type:      "bot",
-			Messageid: hub.GenerateMessageID(),
-			From:      msg.From,
-			To:        msg.To,
-			Body:      bot.Body,
+		if err := handleFrame(ctx, c, &msg); err != nil {
+			log.Printf("%s frame from %s failed: %v", msg.Type, c.UserID, err)
+			replyError(c, &msg, err)
+			continue
 		}
 
-		if err := services.SaveMessage(ctx, &services.MessageDoc{
-			MsgID:    botMsg.Messageid,
-			From:     botMsg.From,
-			To:       botMsg.To,
-			Body:     botMsg.Body,
-			Type:     botMsg.Type,
-			Notified: hub.GlobalHub.IsUserConnected(botMsg.To),
-		}); err != nil {
-			log.Printf("failed to save bot message %s: %v", botMsg.Messageid, err)
-		} else {
-			log.Printf("Successfully saved bot message %s", botMsg.Messageid)
+		// Chat frames are acknowledged with their server ID by handleChat.
+		if msg.CorrelationID != "" && msg.Type != "chat" {
+			c.Deliver(ackMessage(&msg, msg.Messageid))
 		}
+	}
+}
 
-		hub.GlobalHub.Send(msg.From, &botMsg)
-		hub.GlobalHub.Send(msg.To, &botMsg)
-		log.Printf("Sent bot message to users %s and %s", msg.From, msg.To)
+// handleFrame dispatches a single client frame by type.
+func handleFrame(ctx context.Context, c *hub.Client, msg *hub.Message) error {
+	switch msg.Type {
+	case "history":
+		return sendHistory(ctx, c, msg)
+
+	case "chat":
+		return handleChat(ctx, c, msg)
+
+	case "typing":
+		return relayTyping(ctx, c, msg)
+
+	case "presence":
+		return sendPresence(ctx, c, msg)
+
+	case "edit", "delete":
+		return handleMessageChange(ctx, c, msg)
+
+	case "delivered", "read":
+		return handleReceipt(ctx, c, msg)
+
+	case "room_create", "room_invite", "room_leave", "rooms":
+		return handleRoomFrame(ctx, c, msg)
+
+	default:
+		return failFrame(errCodeUnknownType, fmt.Errorf("unknown message type: %q", msg.Type))
 	}
 }
 
-func readPump(ctx context.Context, c *hub.Client) {
-	defer func() {
-		hub.GlobalHub.Unregister(c)
-		c.Conn.Close()
-	}()
+// handleChat persists a chat frame once, delivers it to every participant and
+// runs bot commands. Frames carrying a nonce the sender already used are
+// acknowledged with the original message ID instead of being stored again.
+func handleChat(ctx context.Context, c *hub.Client, msg *hub.Message) error {
+	msg.From = c.UserID
+	msg.Messageid = hub.GenerateMessageID()
+	msg.Payload = nil // only the bot attaches structured payloads
+
+	switch {
+	case strings.TrimSpace(msg.To) == "":
+		return failFrame(errCodeValidation, errors.New("recipient is required"))
+	case strings.TrimSpace(msg.Body) == "":
+		return services.ErrEmptyMessage
+	case len(msg.Nonce) > maxNonceLength:
+		return failFrame(errCodeValidation, errors.New("nonce too long"))
+	}
 
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.Conn.SetPongHandler(func(string) error {
-		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	recipients, err := sendRecipients(ctx, c.UserID, msg.To)
+	if err != nil {
+		return err
+	}
+
+	err = services.SaveMessage(ctx, &services.MessageDoc{
+		MsgID:    msg.Messageid,
+		From:     msg.From,
+		To:       msg.To,
+		Body:     msg.Body,
+		Type:     msg.Type,
+		Notified: !services.IsRoomID(msg.To) && hub.GlobalHub.IsUserConnected(msg.To),
+		Nonce:    msg.Nonce,
 	})
+	if errors.Is(err, services.ErrDuplicateMessage) {
+		existing, err := services.FindMessageByNonce(ctx, c.UserID, msg.Nonce)
+		if err != nil {
+			return failFrame(errCodePersistence, err)
+		}
+		c.Deliver(ackMessage(msg, existing.MsgID))
+		return nil
+	}
+	if err != nil {
+		return failFrame(errCodePersistence, err)
+	}
+	c.Deliver(ackMessage(msg, msg.Messageid))
 
-	for {
-		var msg hub.Message
-		if err := c.Conn.ReadJSON(&msg); err != nil {
-			break
+	// Send to every participant (online or offline)
+	hub.GlobalHub.SendMany(recipients, msg)
+
+	// Bot commands run off the read loop so a slow lookup never blocks the socket.
+	if isBotCommand(msg.Body) {
+		if err := bots.Submit(msg, recipients); err != nil {
+			replyBotBusy(c, msg, err)
 		}
+	}
+	return nil
+}
 
-		switch msg.Type {
-		case "history":
-			history, err := services.LoadRecentMessages(ctx, c.UserID, msg.To, 50)
-			if err != nil {
-				log.Printf("error loading history: %v", err)
-				continue
-			}
-			for _, m := range history {
-				msgType := m.Type
-				if msgType == "" {
-					msgType = "chat" // Default for old messages
-				}
-				_ = c.Conn.WriteJSON(hub.Message{
-					Type:      msgType, // Use the stored type
-					Messageid: m.MsgID,
-					From:      m.From,
-					To:        m.To,
-					Body:      m.Body,
-				})
-			}
+// storedMessage converts a persisted message into the frame sent to clients.
+func storedMessage(m *services.MessageDoc) *hub.Message {
+	msgType := m.Type
+	if msgType == "" {
+		msgType = "chat" // Default for old messages
+	}
+	delivered, read := m.ReceiptUsers()
+	body, payload := m.DisplayPayload()
+	return &hub.Message{
+		Type:        msgType, // Use the stored type
+		Messageid:   m.MsgID,
+		From:        m.From,
+		To:          m.To,
+		Body:        body,
+		Payload:     payload,
+		DeliveredTo: delivered,
+		ReadBy:      read,
+		Edited:      m.EditedAt != nil,
+		Deleted:     m.Deleted,
+	}
+}
 
-		case "chat":
-			msg.From = c.UserID
-			msg.Messageid = hub.GenerateMessageID()
-
-			if err := services.SaveMessage(ctx, &services.MessageDoc{
-				MsgID:    msg.Messageid,
-				From:     msg.From,
-				To:       msg.To,
-				Body:     msg.Body,
-				Type:     msg.Type,
-				Notified: hub.GlobalHub.IsUserConnected(msg.To),
-			}); err != nil {
-				log.Printf("failed to save message %s: %v", msg.Messageid, err)
-			}
+// sendHistory replies with one page of a conversation followed by a
+// "history_end" frame carrying the page cursors and whether more remain.
+func sendHistory(ctx context.Context, c *hub.Client, msg *hub.Message) error {
+	if _, err := conversationRecipients(ctx, c.UserID, msg.To); err != nil {
+		return err
+	}
+
+	limit := msg.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	history, hasMore, err := services.LoadMessagePage(ctx, c.UserID, msg.To, msg.Before, msg.After, limit)
+	if err != nil {
+		return err
+	}
+
+	end := &hub.Message{
+		Type:          "history_end",
+		To:            msg.To,
+		Count:         len(history),
+		HasMore:       hasMore,
+		CorrelationID: msg.CorrelationID,
+	}
+	for i := range history {
+		c.Deliver(storedMessage(&history[i]))
+	}
+	if len(history) > 0 {
+		end.Before = history[0].MsgID
+		end.After = history[len(history)-1].MsgID
+	}
+	c.Deliver(end)
+	return nil
+}
+
+// sendPresence answers a presence query for the listed users, skipping anyone
+// who is not one of the requester's conversation peers or room-mates.
+func sendPresence(ctx context.Context, c *hub.Client, msg *hub.Message) error {
+	peers, err := services.PresencePeers(ctx, c.UserID)
+	if err != nil {
+		return err
+	}
+	allowed := make(map[string]bool, len(peers))
+	for _, id := range peers {
+		allowed[id] = true
+	}
+	for _, id := range msg.Members {
+		if !allowed[id] {
+			continue
+		}
+		status := hub.PresenceOffline
+		if hub.GlobalHub.IsUserConnected(id) {
+			status = hub.PresenceOnline
+		}
+		c.Deliver(hub.PresenceMessage(id, status))
+	}
+	return nil
+}
 
-			// Send to both users (online or offline)
-			hub.GlobalHub.Send(msg.From, &msg)
-			hub.GlobalHub.Send(msg.To, &msg)
+// handleMessageChange applies an edit or delete from the message's author and
+// rebroadcasts the updated message to every participant.
+func handleMessageChange(ctx context.Context, c *hub.Client, msg *hub.Message) error {
+	var (
+		doc *services.MessageDoc
+		err error
+	)
+	if msg.Type == "edit" {
+		doc, err = services.EditMessage(ctx, msg.Messageid, c.UserID, msg.Body)
+	} else {
+		doc, err = services.DeleteMessage(ctx, msg.Messageid, c.UserID)
+	}
+	if err != nil {
+		return err
+	}
 
-			// Process bot commands
-			processBotCommands(ctx, &msg)
+	recipients, err := conversationRecipients(ctx, doc.From, doc.To)
+	if err != nil {
+		return err
+	}
+	hub.GlobalHub.SendMany(recipients, &hub.Message{
+		Type:      msg.Type,
+		Messageid: doc.MsgID,
+		From:      doc.From,
+		To:        doc.To,
+		Body:      doc.Body,
+		Edited:    doc.EditedAt != nil,
+		Deleted:   doc.Deleted,
+	})
+	return nil
+}
+
+// relayTyping forwards an ephemeral typing indicator to the other participants
+// of a conversation. Typing frames are never persisted, so they carry only a
+// "start" or "stop" state and never client text.
+func relayTyping(ctx context.Context, c *hub.Client, msg *hub.Message) error {
+	if msg.Body != "start" && msg.Body != "stop" {
+		return failFrame(errCodeValidation, errors.New(`typing state must be "start" or "stop"`))
+	}
+	recipients, err := sendRecipients(ctx, c.UserID, msg.To)
+	if err != nil {
+		return err
+	}
 
-		default:
-			log.Printf("unknown message type: %q", msg.Type)
+	typing := &hub.Message{
+		Type: "typing",
+		From: c.UserID,
+		To:   msg.To,
+		Body: msg.Body,
+	}
+	for _, id := range recipients {
+		if id != c.UserID {
+			hub.GlobalHub.Send(id, typing)
 		}
 	}
+	return nil
 }
 
-// writePump pumps messages from the hub to the WebSocket.
-func writePump(c *hub.Client) {
+// handleReceipt records a delivery or read acknowledgement for a message and
+// forwards it to the sender's connections.
+func handleReceipt(ctx context.Context, c *hub.Client, msg *hub.Message) error {
+	var (
+		doc     *services.MessageDoc
+		changed bool
+		err     error
+	)
+	if msg.Type == "read" {
+		doc, changed, err = services.MarkMessageRead(ctx, msg.Messageid, c.UserID)
+	} else {
+		doc, changed, err = services.MarkMessageDelivered(ctx, msg.Messageid, c.UserID)
+	}
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	hub.GlobalHub.Send(doc.From, &hub.Message{
+		Type:      msg.Type,
+		Messageid: doc.MsgID,
+		From:      c.UserID,
+		To:        doc.To,
+	})
+	return nil
+}
+
+// writePump pumps messages from the hub to the WebSocket. Messages whose IDs
+// are in skip were already written during replay and are dropped once.
+func writePump(c *hub.Client, skip map[string]bool) {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
@@ -222,6 +429,10 @@ func writePump(c *hub.Client) {
 			if !ok {
 				return
 			}
+			if skip[msg.Messageid] {
+				delete(skip, msg.Messageid)
+				continue
+			}
 			if err := c.Conn.WriteJSON(msg); err != nil {
 				return
 			}
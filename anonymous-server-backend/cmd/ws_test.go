@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWsHandlerRejectsHandshake(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "missing token", query: ""},
+		{name: "malformed token", query: "?token=garbage"},
+		{name: "alg none", query: "?token=eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJzdWIiOiJhbGljZSJ9."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws"+tt.query, nil)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", "13")
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			rec := httptest.NewRecorder()
+			WsHandler(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -64,6 +64,7 @@ func readViperConfig(appName string) *viper.Viper {
 	v.SetDefault("frontend_url", "http://localhost:3000")
 	v.SetDefault("stock_api", "http://python-service:5005")
 	v.SetDefault("backend_url", "http://localhost:8081")
+	v.SetDefault("hub_broker", "local") // "local" or "mongo" (requires a replica set)
 	return v
 }
 
@@ -0,0 +1,108 @@
+package hub
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// slowConsumerGrace is how long a client's Send buffer may stay full
+	// before the client is disconnected.
+	slowConsumerGrace = 5 * time.Second
+
+	// CloseResync is the close code sent to a disconnected slow consumer.
+	// Clients should reconnect and resync (e.g. with ?since=<last message ID>).
+	CloseResync = 4000
+)
+
+// Stats reports hub-wide connection and backpressure counters.
+type Stats struct {
+	Users       int    `json:"users"`
+	Connections int    `json:"connections"`
+	Dropped     uint64 `json:"dropped"`
+	Evicted     uint64 `json:"evicted"`
+}
+
+// Stats returns a snapshot of the hub's counters.
+func (h *Hub) Stats() Stats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	st := Stats{
+		Users:   len(h.clients),
+		Dropped: h.dropped.Load(),
+		Evicted: h.evicted.Load(),
+	}
+	for _, conns := range h.clients {
+		st.Connections += len(conns)
+	}
+	return st
+}
+
+// Dropped returns how many messages were dropped for this client.
+func (c *Client) Dropped() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// recordDelivered ends any run of drops for the client.
+func (c *Client) recordDelivered() {
+	c.mu.Lock()
+	c.fullSince = time.Time{}
+	c.mu.Unlock()
+}
+
+// recordDrop counts a dropped message and evicts the client once its buffer
+// has stayed full for longer than slowConsumerGrace.
+func (c *Client) recordDrop() {
+	now := time.Now()
+
+	c.mu.Lock()
+	c.dropped++
+	if c.fullSince.IsZero() {
+		c.fullSince = now
+	}
+	evict := !c.evicted && now.Sub(c.fullSince) >= slowConsumerGrace
+	if evict {
+		c.evicted = true
+	}
+	dropped := c.dropped
+	c.mu.Unlock()
+
+	if c.hub != nil {
+		c.hub.dropped.Add(1)
+	}
+	if dropped == 1 {
+		log.Printf("hub: send buffer full for %s, dropping messages", c.UserID)
+	}
+	if !evict {
+		return
+	}
+
+	if c.hub != nil {
+		c.hub.evicted.Add(1)
+	}
+	log.Printf("hub: disconnecting slow consumer %s after %d dropped messages", c.UserID, dropped)
+	go c.closeSlow()
+}
+
+// closeSlow tells the client to resync and closes its connection, which ends
+// its pumps and unregisters it.
+func (c *Client) closeSlow() {
+	c.sendClose(CloseResync, "slow consumer, resync required")
+	if c.Conn != nil {
+		c.Conn.Close()
+	}
+}
+
+// sendClose writes a close frame with the given code and reason.
+func (c *Client) sendClose(code int, reason string) {
+	if c.Conn == nil {
+		return
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
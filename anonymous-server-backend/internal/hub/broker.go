@@ -0,0 +1,36 @@
+package hub
+
+import "context"
+
+// Broker fans hub traffic out to other backend instances. The hub always
+// delivers to its own connections first and hands the same message to the
+// broker so peers can deliver to theirs.
+type Broker interface {
+	// Publish forwards msg for the listed users to other instances. An empty
+	// list broadcasts to every user connected elsewhere.
+	Publish(to []string, msg *Message) error
+	// Subscribe calls deliver for messages published by other instances until
+	// ctx is done or the subscription fails.
+	Subscribe(ctx context.Context, deliver func(to []string, msg *Message)) error
+	// SetPresence records whether userID has connections on this instance.
+	SetPresence(userID string, online bool) error
+	// IsRemoteConnected reports whether userID is connected to another instance.
+	IsRemoteConnected(userID string) bool
+}
+
+// localBroker is the single-instance Broker: there is nobody to fan out to.
+type localBroker struct{}
+
+// NewLocalBroker returns a Broker for running a single backend instance.
+func NewLocalBroker() Broker { return localBroker{} }
+
+func (localBroker) Publish([]string, *Message) error { return nil }
+
+func (localBroker) Subscribe(ctx context.Context, _ func([]string, *Message)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (localBroker) SetPresence(string, bool) error { return nil }
+
+func (localBroker) IsRemoteConnected(string) bool { return false }
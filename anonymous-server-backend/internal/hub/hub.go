@@ -1,45 +1,186 @@
 package hub
 
 import (
+	"context"
+	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type Message struct {
-	Messageid string `json:"messageid"`
-	From      string `json:"from"`
-	To        string `json:"to"`
-	Body      string `json:"body"`
-	Type      string `json:"type"` // "chat" or "history"
-	Count     int    `json:"count,omitempty"`
+	Messageid string   `json:"messageid"`
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Body      string   `json:"body"`
+	Type      string   `json:"type"` // "chat" or "history"
+	Count     int      `json:"count,omitempty"`
+	Members   []string `json:"members,omitempty"`
+	// DeliveredTo and ReadBy list recipients that acknowledged the message.
+	DeliveredTo []string `json:"deliveredTo,omitempty"`
+	ReadBy      []string `json:"readBy,omitempty"`
+	Edited      bool     `json:"edited,omitempty"`
+	Deleted     bool     `json:"deleted,omitempty"`
+	// Before, After and Limit page through "history"; HasMore marks further pages.
+	Before  string `json:"before,omitempty"`
+	After   string `json:"after,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+	HasMore bool   `json:"hasMore,omitempty"`
+	// Nonce is a client-generated idempotency key for "chat" frames.
+	Nonce string `json:"nonce,omitempty"`
+	// CorrelationID is echoed on the "ack" or "error" reply to a client frame.
+	CorrelationID string `json:"correlationId,omitempty"`
+	// Code is a machine-readable error code on "error" frames.
+	Code string `json:"code,omitempty"`
+	// Payload is structured content, e.g. a bot quote or chart, see payload.go.
+	Payload *Payload `json:"payload,omitempty"`
 }
 
 type Client struct {
 	Conn   *websocket.Conn
 	UserID string
 	Send   chan *Message
+
+	hub *Hub
+	// slow-consumer bookkeeping, see backpressure.go
+	mu        sync.Mutex
+	dropped   uint64
+	fullSince time.Time
+	evicted   bool
+}
+
+// Deliver queues msg for this connection only. If the buffer is full the
+// message is dropped and counted; clients that stay full are disconnected.
+func (c *Client) Deliver(msg *Message) bool {
+	select {
+	case c.Send <- msg:
+		c.recordDelivered()
+		return true
+	default:
+		c.recordDrop()
+		return false
+	}
+}
+
+// Presence statuses carried in the Body of "presence" frames.
+const (
+	PresenceOnline  = "online"
+	PresenceOffline = "offline"
+)
+
+// PresenceMessage builds an ephemeral "presence" frame for userID.
+func PresenceMessage(userID, status string) *Message {
+	return &Message{
+		Type:      "presence",
+		Messageid: GenerateMessageID(),
+		From:      userID,
+		Body:      status,
+	}
 }
 
 type Hub struct {
 	// map of userID -> client
 	clients map[string][]*Client
 	mu      sync.RWMutex
+
+	dropped atomic.Uint64
+	evicted atomic.Uint64
+
+	broker Broker
+	// audience lists who may see a user's presence, see SetPresenceAudience.
+	audience func(ctx context.Context, userID string) ([]string, error)
+	// onRevoke runs for tokens revoked on other instances, see revoke.go.
+	onRevoke func(userID, jti string)
 }
 
+// presenceTimeout bounds the audience lookup for one presence change.
+const presenceTimeout = 5 * time.Second
+
 var GlobalHub = &Hub{
 	clients: make(map[string][]*Client),
+	broker:  NewLocalBroker(),
+}
+
+// SetBroker replaces the broker used to reach other backend instances. It
+// must be called before clients connect.
+func (h *Hub) SetBroker(b Broker) {
+	h.broker = b
 }
 
+// SetPresenceAudience sets the lookup for which users are told when userID
+// comes online or goes offline. Without one, presence is never announced. It
+// must be called before clients connect.
+func (h *Hub) SetPresenceAudience(f func(ctx context.Context, userID string) ([]string, error)) {
+	h.audience = f
+}
+
+// Run delivers messages published by other instances to local clients until
+// ctx is done, resubscribing after transient broker failures.
+func (h *Hub) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := h.broker.Subscribe(ctx, func(to []string, msg *Message) {
+			if msg.Type == revokeMessageType {
+				h.applyRevoke(msg)
+				return
+			}
+			if len(to) == 0 {
+				h.broadcastLocal(msg)
+				return
+			}
+			for _, id := range to {
+				h.sendLocal(id, msg)
+			}
+		})
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		log.Printf("hub: broker subscription failed, retrying: %v", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// publish hands msg to the broker for delivery on other instances.
+func (h *Hub) publish(to []string, msg *Message) {
+	if err := h.broker.Publish(to, msg); err != nil {
+		log.Printf("hub: failed to publish %s message: %v", msg.Type, err)
+	}
+}
+
+// setPresence records a user's local presence with the broker.
+func (h *Hub) setPresence(userID string, online bool) {
+	if err := h.broker.SetPresence(userID, online); err != nil {
+		log.Printf("hub: failed to record presence for %s: %v", userID, err)
+	}
+}
+
+// Register adds a client, announcing the user as online if this is their
+// first connection anywhere in the cluster.
 func (h *Hub) Register(c *Client) {
+	c.hub = h
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	first := len(h.clients[c.UserID]) == 0
 	h.clients[c.UserID] = append(h.clients[c.UserID], c)
+	h.mu.Unlock()
+
+	if first {
+		// Already online elsewhere in the cluster, so nobody needs telling.
+		remote := h.broker.IsRemoteConnected(c.UserID)
+		h.setPresence(c.UserID, true)
+		if !remote {
+			h.broadcastPresence(c.UserID, PresenceOnline)
+		}
+	}
 }
 
+// Unregister removes a client, announcing the user as offline if this was
+// their last connection anywhere in the cluster.
 func (h *Hub) Unregister(c *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	conns := h.clients[c.UserID]
 	// filter out this client
 	for i, cli := range conns {
@@ -54,24 +195,88 @@ func (h *Hub) Unregister(c *Client) {
 		h.clients[c.UserID] = conns
 	}
 	close(c.Send)
+	last := len(conns) == 0
+	h.mu.Unlock()
+
+	if last {
+		// Still online on another instance, so the user has not gone offline.
+		remote := h.broker.IsRemoteConnected(c.UserID)
+		h.setPresence(c.UserID, false)
+		if !remote {
+			h.broadcastPresence(c.UserID, PresenceOffline)
+		}
+	}
+}
+
+// broadcastPresence tells userID's presence audience, on any instance, that
+// userID changed status.
+func (h *Hub) broadcastPresence(userID, status string) {
+	if h.audience == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+	peers, err := h.audience(ctx, userID)
+	if err != nil {
+		log.Printf("hub: failed to load presence audience for %s: %v", userID, err)
+		return
+	}
+	if len(peers) > 0 {
+		h.SendMany(peers, PresenceMessage(userID, status))
+	}
+}
+
+// broadcastLocal delivers msg to every local connection except the sender's.
+func (h *Hub) broadcastLocal(msg *Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for id, conns := range h.clients {
+		if id == msg.From {
+			continue
+		}
+		for _, c := range conns {
+			c.Deliver(msg)
+		}
+	}
 }
 
+// Send delivers msg to every connection of a user, on this or any other instance.
 func (h *Hub) Send(to string, msg *Message) {
+	h.sendLocal(to, msg)
+	h.publish([]string{to}, msg)
+}
+
+// sendLocal delivers msg to a user's connections on this instance only.
+func (h *Hub) sendLocal(to string, msg *Message) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	for _, c := range h.clients[to] {
 		// avoid blocking the loop if one channel is full
-		select {
-		case c.Send <- msg:
-		default:
+		c.Deliver(msg)
+	}
+}
+
+// SendMany delivers msg to every connection of each listed user, once per user.
+func (h *Hub) SendMany(to []string, msg *Message) {
+	seen := make(map[string]bool, len(to))
+	users := make([]string, 0, len(to))
+	for _, id := range to {
+		if seen[id] {
+			continue
 		}
+		seen[id] = true
+		users = append(users, id)
+		h.sendLocal(id, msg)
 	}
+	h.publish(users, msg)
 }
 
+// IsUserConnected reports whether the user has a connection on any instance.
 func (h *Hub) IsUserConnected(userID string) bool {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	local := len(h.clients[userID]) > 0
+	h.mu.RUnlock()
 
-	return len(h.clients[userID]) > 0
+	return local || h.broker.IsRemoteConnected(userID)
 }
@@ -0,0 +1,253 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// eventTTL bounds how long fan-out events are kept once published.
+	eventTTL = time.Minute
+	// presenceTTL expires presence rows of instances that stopped heartbeating.
+	presenceTTL = 90 * time.Second
+	// presenceHeartbeat is how often live presence rows are refreshed.
+	presenceHeartbeat = 30 * time.Second
+	// mongoOpTimeout bounds each broker round trip to MongoDB.
+	mongoOpTimeout = 2 * time.Second
+	// changeStreamHistoryLost is the server error for an expired resume token.
+	changeStreamHistoryLost = 286
+)
+
+// hubEvent is a message published for delivery on other instances.
+type hubEvent struct {
+	Instance  string    `bson:"instance"`
+	To        []string  `bson:"to"`
+	Msg       *Message  `bson:"msg"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+// presenceDoc records that a user has connections on one instance.
+type presenceDoc struct {
+	UserID    string    `bson:"userId"`
+	Instance  string    `bson:"instance"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// MongoBroker fans hub traffic out between instances through MongoDB. Events
+// are inserted into a collection and picked up by every other instance with a
+// change stream, so the deployment must run MongoDB as a replica set.
+type MongoBroker struct {
+	instance string
+	events   *mongo.Collection
+	presence *mongo.Collection
+
+	mu    sync.Mutex
+	local map[string]bool // users connected to this instance
+
+	// resumeToken is where the next Subscribe picks the change stream back
+	// up, so events published while resubscribing are not lost. Only
+	// Subscribe touches it, and Hub.Run never runs two at once.
+	resumeToken bson.Raw
+}
+
+// NewMongoBroker returns a Broker that uses collections in db.
+func NewMongoBroker(db *mongo.Database) *MongoBroker {
+	return &MongoBroker{
+		instance: ulid.Make().String(),
+		events:   db.Collection("hub_events"),
+		presence: db.Collection("hub_presence"),
+		local:    make(map[string]bool),
+	}
+}
+
+// EnsureIndexes creates the TTL and lookup indexes the broker relies on.
+func (b *MongoBroker) EnsureIndexes(ctx context.Context) error {
+	_, err := b.events.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(eventTTL.Seconds())),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = b.presence.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "instance", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(presenceTTL.Seconds())),
+		},
+	})
+	return err
+}
+
+// Publish implements Broker.
+func (b *MongoBroker) Publish(to []string, msg *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+
+	_, err := b.events.InsertOne(ctx, hubEvent{
+		Instance:  b.instance,
+		To:        to,
+		Msg:       msg,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+// Subscribe implements Broker. It also keeps this instance's presence rows
+// fresh for as long as it runs.
+func (b *MongoBroker) Subscribe(ctx context.Context, deliver func(to []string, msg *Message)) error {
+	hbCtx, stopHeartbeat := context.WithCancel(ctx)
+	hbDone := make(chan struct{})
+	go func() {
+		b.heartbeat(hbCtx)
+		close(hbDone)
+	}()
+	defer func() {
+		stopHeartbeat()
+		<-hbDone
+	}()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"operationType":         "insert",
+			"fullDocument.instance": bson.M{"$ne": b.instance},
+		}}},
+	}
+	opts := options.ChangeStream()
+	if b.resumeToken != nil {
+		opts.SetResumeAfter(b.resumeToken)
+	}
+	stream, err := b.events.Watch(ctx, pipeline, opts)
+	if err != nil {
+		// The token fell off the oplog; those events are gone, start fresh.
+		var se mongo.ServerError
+		if errors.As(err, &se) && se.HasErrorCode(changeStreamHistoryLost) {
+			b.resumeToken = nil
+		}
+		return err
+	}
+	defer stream.Close(context.Background())
+	defer func() {
+		if token := stream.ResumeToken(); token != nil {
+			b.resumeToken = token
+		}
+	}()
+
+	for stream.Next(ctx) {
+		b.resumeToken = stream.ResumeToken()
+		var change struct {
+			FullDocument hubEvent `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			log.Printf("hub: failed to decode broker event: %v", err)
+			continue
+		}
+		if change.FullDocument.Msg == nil {
+			continue
+		}
+		deliver(change.FullDocument.To, change.FullDocument.Msg)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return stream.Err()
+}
+
+// SetPresence implements Broker.
+func (b *MongoBroker) SetPresence(userID string, online bool) error {
+	b.mu.Lock()
+	if online {
+		b.local[userID] = true
+	} else {
+		delete(b.local, userID)
+	}
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+
+	filter := bson.M{"userId": userID, "instance": b.instance}
+	if !online {
+		_, err := b.presence.DeleteOne(ctx, filter)
+		return err
+	}
+	_, err := b.presence.UpdateOne(ctx, filter,
+		bson.M{"$set": bson.M{"updatedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// IsRemoteConnected implements Broker.
+func (b *MongoBroker) IsRemoteConnected(userID string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+	defer cancel()
+
+	n, err := b.presence.CountDocuments(ctx, bson.M{
+		"userId":    userID,
+		"instance":  bson.M{"$ne": b.instance},
+		"updatedAt": bson.M{"$gt": time.Now().Add(-presenceTTL)},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		log.Printf("hub: failed to check remote presence for %s: %v", userID, err)
+		return false
+	}
+	return n > 0
+}
+
+// heartbeat keeps presence rows for users connected to this instance alive
+// past presenceTTL, and removes them when ctx ends.
+func (b *MongoBroker) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(presenceHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		b.refreshPresence(ctx)
+
+		select {
+		case <-ctx.Done():
+			cleanup, cancel := context.WithTimeout(context.Background(), mongoOpTimeout)
+			if _, err := b.presence.DeleteMany(cleanup, bson.M{"instance": b.instance}); err != nil {
+				log.Printf("hub: failed to clear presence for instance %s: %v", b.instance, err)
+			}
+			cancel()
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshPresence upserts a presence row for every locally connected user.
+func (b *MongoBroker) refreshPresence(ctx context.Context) {
+	b.mu.Lock()
+	models := make([]mongo.WriteModel, 0, len(b.local))
+	now := time.Now()
+	for id := range b.local {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"userId": id, "instance": b.instance}).
+			SetUpdate(bson.M{"$set": bson.M{"updatedAt": now}}).
+			SetUpsert(true))
+	}
+	b.mu.Unlock()
+	if len(models) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mongoOpTimeout)
+	defer cancel()
+	if _, err := b.presence.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil && ctx.Err() == nil {
+		log.Printf("hub: presence heartbeat failed: %v", err)
+	}
+}
@@ -2,17 +2,31 @@ package hub
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/oklog/ulid/v2"
 )
 
-var entropy = ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
+// entropy keeps IDs generated in the same millisecond increasing. It is not
+// safe for concurrent use, so it is only read with entropyMu held.
+var (
+	entropyMu sync.Mutex
+	entropy   = ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
+)
 
 func GenerateMessageID() string {
+	entropyMu.Lock()
 	id, err := ulid.New(ulid.Timestamp(time.Now()), entropy)
+	entropyMu.Unlock()
 	if err != nil {
 		panic(err)
 	}
 	return id.String() // e.g. "01ARZ3NDEKTSV4RRFFQ69G5FAV"
 }
+
+// IsMessageID reports whether s is a well-formed message ULID.
+func IsMessageID(s string) bool {
+	_, err := ulid.ParseStrict(s)
+	return err == nil
+}
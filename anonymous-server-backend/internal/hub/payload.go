@@ -0,0 +1,83 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PayloadVersion is the schema version stamped on payloads built by NewPayload.
+const PayloadVersion = 1
+
+// Payload kinds understood by the frontend.
+const (
+	PayloadQuote = "quote"
+	PayloadChart = "chart"
+	PayloadNews  = "news"
+	PayloadTable = "table"
+	// PayloadCompare is several chart series rebased to a common start.
+	PayloadCompare = "compare"
+)
+
+var errPayloadNotObject = errors.New("payload data must be a JSON object")
+
+// Payload is machine-readable content attached to a message, typically a bot
+// reply. Body still carries a plain-text rendering for clients that ignore it.
+type Payload struct {
+	Kind    string          `json:"kind"`
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewPayload encodes data as a payload of the given kind at PayloadVersion.
+func NewPayload(kind string, data any) (*Payload, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{Kind: kind, Version: PayloadVersion, Data: raw}, nil
+}
+
+// Decode unmarshals the payload data into out.
+func (p *Payload) Decode(out any) error {
+	return json.Unmarshal(p.Data, out)
+}
+
+// payloadDoc is how a Payload is laid out in MongoDB, with Data stored as a
+// nested document rather than opaque bytes so it stays queryable.
+type payloadDoc struct {
+	Kind    string   `bson:"kind"`
+	Version int      `bson:"version"`
+	Data    bson.Raw `bson:"data,omitempty"`
+}
+
+// MarshalBSON stores Data as a BSON document.
+func (p Payload) MarshalBSON() ([]byte, error) {
+	doc := payloadDoc{Kind: p.Kind, Version: p.Version}
+	if len(p.Data) > 0 {
+		if err := bson.UnmarshalExtJSON(p.Data, false, &doc.Data); err != nil {
+			return nil, fmt.Errorf("%w: %v", errPayloadNotObject, err)
+		}
+	}
+	return bson.Marshal(doc)
+}
+
+// UnmarshalBSON restores Data from its BSON document form.
+func (p *Payload) UnmarshalBSON(b []byte) error {
+	var doc payloadDoc
+	if err := bson.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	p.Kind, p.Version, p.Data = doc.Kind, doc.Version, nil
+	if len(doc.Data) == 0 {
+		return nil
+	}
+	data, err := bson.MarshalExtJSON(doc.Data, false, false)
+	if err != nil {
+		return err
+	}
+	p.Data = data
+	return nil
+}
@@ -0,0 +1,63 @@
+package hub
+
+import "log"
+
+const (
+	// CloseSessionRevoked is the close code sent to connections whose user
+	// logged out everywhere. Clients should not reconnect with the same token.
+	CloseSessionRevoked = 4001
+
+	// revokeMessageType marks broker events that revoke a user's sessions.
+	// They are handled by the hub and never delivered to clients.
+	revokeMessageType = "session_revoked"
+)
+
+// SetRevokeHandler sets the callback run when another instance revokes a
+// user's tokens, e.g. to drop cached token checks. jti is empty when every
+// token of the user was revoked. It must be called before Run.
+func (h *Hub) SetRevokeHandler(f func(userID, jti string)) {
+	h.onRevoke = f
+}
+
+// Revoke tells every other instance that a token of userID was revoked. When
+// jti is empty all of the user's tokens were, and their connections on every
+// instance are closed.
+func (h *Hub) Revoke(userID, jti string) {
+	if jti == "" {
+		h.disconnectLocal(userID)
+	}
+	h.publish([]string{userID}, &Message{
+		Type:      revokeMessageType,
+		Messageid: GenerateMessageID(),
+		From:      userID,
+		Body:      jti,
+	})
+}
+
+// applyRevoke handles a revoke event published by another instance.
+func (h *Hub) applyRevoke(msg *Message) {
+	if h.onRevoke != nil {
+		h.onRevoke(msg.From, msg.Body)
+	}
+	if msg.Body == "" {
+		h.disconnectLocal(msg.From)
+	}
+}
+
+// disconnectLocal closes userID's connections on this instance, which ends
+// their pumps and unregisters them.
+func (h *Hub) disconnectLocal(userID string) {
+	h.mu.RLock()
+	conns := append([]*Client(nil), h.clients[userID]...)
+	h.mu.RUnlock()
+
+	if len(conns) > 0 {
+		log.Printf("hub: closing %d connections of %s after logout", len(conns), userID)
+	}
+	for _, c := range conns {
+		c.sendClose(CloseSessionRevoked, "logged out")
+		if c.Conn != nil {
+			c.Conn.Close()
+		}
+	}
+}
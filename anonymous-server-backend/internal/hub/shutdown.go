@@ -0,0 +1,47 @@
+package hub
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Shutdown sends every connected client a "server restarting" close frame and
+// waits for their pumps to finish and unregister. Clients still connected when
+// ctx is done are closed forcibly and ctx's error is returned.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	for _, c := range h.allClients() {
+		c.sendClose(websocket.CloseServiceRestart, "server restarting")
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if h.Stats().Connections == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			for _, c := range h.allClients() {
+				if c.Conn != nil {
+					c.Conn.Close()
+				}
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// allClients returns a snapshot of every local connection.
+func (h *Hub) allClients() []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var all []*Client
+	for _, conns := range h.clients {
+		all = append(all, conns...)
+	}
+	return all
+}
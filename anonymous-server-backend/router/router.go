@@ -1,21 +1,69 @@
 package router
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/zelshahawy/Anonymous_backend/cmd"
 	"github.com/zelshahawy/Anonymous_backend/config"
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
 	"github.com/zelshahawy/Anonymous_backend/services"
 )
 
+// shutdownTimeout bounds how long StartServer waits for requests, WebSocket
+// clients and bot commands to finish after SIGINT/SIGTERM.
+const shutdownTimeout = 20 * time.Second
+
+// StartServer serves the API until SIGINT or SIGTERM, then shuts down gracefully.
 func StartServer() {
 	config.LoadConfig()
 	config.InitDBClients()
 	defer config.DisconnectDB()
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := services.EnsureIndexes(ctx); err != nil {
+		fmt.Printf("Error creating indexes: %v\n", err)
+	}
+	cancel()
+
+	if config.Config().GetString("hub_broker") == "mongo" {
+		broker := hub.NewMongoBroker(config.DBClients.MongoClient.Database(config.Configuration.Database))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := broker.EnsureIndexes(ctx); err != nil {
+			fmt.Printf("Error creating hub broker indexes: %v\n", err)
+		}
+		cancel()
+		hub.GlobalHub.SetBroker(broker)
+		fmt.Println("Using MongoDB hub broker for cross-instance delivery")
+	}
+	hub.GlobalHub.SetPresenceAudience(services.PresencePeers)
+	hub.GlobalHub.SetRevokeHandler(services.ForgetRevocations)
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	hubDone := make(chan struct{})
+	go func() {
+		hub.GlobalHub.Run(hubCtx)
+		close(hubDone)
+	}()
+
+	// Background jobs stop before the hub so their last messages still go out.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	for _, run := range []func(context.Context){services.RunAlerts, services.RunDigests} {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			run(jobsCtx)
+		}()
+	}
+
 	// Set up CORS middleware
 	corsMiddleware := handlers.CORS(
 		handlers.AllowedOrigins([]string{
@@ -39,16 +87,54 @@ func StartServer() {
 
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 	router.HandleFunc("/ws", cmd.WsHandler).Methods("GET", "OPTIONS")
+	router.HandleFunc("/commands", cmd.CommandsHandler).Methods("GET", "OPTIONS")
+	router.HandleFunc("/health", cmd.HealthHandler).Methods("GET", "OPTIONS")
 
 	// Protected routes
 	protected := router.NewRoute().Subrouter()
 	protected.Use(services.AuthMiddleware)
 	protected.HandleFunc("/heartbeat", cmd.HeartbeatHandler).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/me", cmd.GetCurrentUserHandler).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/logout/all", cmd.LogoutAllHandler).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/stats/hub", cmd.HubStatsHandler).Methods("GET", "OPTIONS")
 	port := "8080"
-	fmt.Printf("Starting server on port %s...\n", port)
+	srv := &http.Server{Addr: ":" + port, Handler: router}
 
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		fmt.Printf("Error starting server: %v\n", err)
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		fmt.Printf("Starting server on port %s...\n", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Error starting server: %v\n", err)
+			stop()
+		}
+	}()
+
+	<-sigCtx.Done()
+	fmt.Println("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connections and let in-flight HTTP requests finish.
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Error shutting down HTTP server: %v\n", err)
+	}
+	// Ask WebSocket clients to reconnect elsewhere and wait for their pumps.
+	if err := hub.GlobalHub.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Error draining WebSocket clients: %v\n", err)
+	}
+	// Bot commands outlive their sockets; give them until the deadline to land.
+	if err := cmd.WaitForBots(shutdownCtx); err != nil {
+		fmt.Printf("Error waiting for bot commands: %v\n", err)
+	}
+	stopJobs()
+	jobs.Wait()
+	stopHub()
+	select {
+	case <-hubDone:
+	case <-shutdownCtx.Done():
 	}
+	fmt.Println("Server stopped")
 }
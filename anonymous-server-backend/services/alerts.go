@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+const (
+	// AlertAbove and AlertBelow are the directions a price alert watches.
+	AlertAbove = "above"
+	AlertBelow = "below"
+
+	// maxAlertsPerUser caps a user's active alerts.
+	maxAlertsPerUser = 20
+	// alertPollInterval is how often active alerts are checked against prices.
+	alertPollInterval = time.Minute
+	// alertPollWorkers is how many symbols are priced concurrently per poll.
+	alertPollWorkers = 4
+)
+
+var (
+	// ErrAlertNotFound is returned when a user has no active alert with the given ID.
+	ErrAlertNotFound = errors.New("alert not found")
+	// ErrTooManyAlerts is returned when a user already has maxAlertsPerUser alerts.
+	ErrTooManyAlerts = errors.New("too many active alerts")
+)
+
+// AlertDoc is a user's price alert. It fires once, when the symbol's price
+// reaches Threshold in Direction, and is then deactivated.
+type AlertDoc struct {
+	AlertID      string     `bson:"alertId"`
+	UserID       string     `bson:"userId"`
+	Symbol       string     `bson:"symbol"`
+	Direction    string     `bson:"direction"`
+	Threshold    float64    `bson:"threshold"`
+	Active       bool       `bson:"active"`
+	CreatedAt    time.Time  `bson:"createdAt"`
+	TriggeredAt  *time.Time `bson:"triggeredAt,omitempty"`
+	TriggerPrice float64    `bson:"triggerPrice,omitempty"`
+}
+
+// crossed reports whether price satisfies the alert.
+func (a *AlertDoc) crossed(price float64) bool {
+	if a.Direction == AlertAbove {
+		return price >= a.Threshold
+	}
+	return price <= a.Threshold
+}
+
+// alertsCollection returns the MongoDB collection handle for price alerts.
+func alertsCollection() *mongo.Collection {
+	dbName := config.Configuration.Database
+	return config.DBClients.MongoClient.Database(dbName).Collection("alerts")
+}
+
+// newAlertID returns a short ID that is easy to type into "/alert rm".
+func newAlertID() string {
+	id := ulid.Make().String()
+	return strings.ToLower(id[len(id)-6:])
+}
+
+// CreateAlert stores an active price alert for userID.
+func CreateAlert(ctx context.Context, userID, symbol, direction string, threshold float64) (*AlertDoc, error) {
+	n, err := alertsCollection().CountDocuments(ctx, bson.M{"userId": userID, "active": true})
+	if err != nil {
+		return nil, err
+	}
+	if n >= maxAlertsPerUser {
+		return nil, ErrTooManyAlerts
+	}
+
+	alert := AlertDoc{
+		AlertID:   newAlertID(),
+		UserID:    userID,
+		Symbol:    symbol,
+		Direction: direction,
+		Threshold: threshold,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	if _, err := alertsCollection().InsertOne(ctx, alert); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// LoadUserAlerts returns a user's active alerts, oldest first.
+func LoadUserAlerts(ctx context.Context, userID string) ([]AlertDoc, error) {
+	cursor, err := alertsCollection().Find(ctx,
+		bson.M{"userId": userID, "active": true},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var alerts []AlertDoc
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// CancelAlert deletes one of userID's active alerts.
+func CancelAlert(ctx context.Context, userID, alertID string) error {
+	res, err := alertsCollection().DeleteOne(ctx, bson.M{
+		"userId":  userID,
+		"alertId": strings.ToLower(alertID),
+		"active":  true,
+	})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
+
+// RunAlerts checks active alerts every alertPollInterval until ctx is done.
+func RunAlerts(ctx context.Context) {
+	ticker := time.NewTicker(alertPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := checkAlerts(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("price alert check failed: %v", err)
+			}
+		}
+	}
+}
+
+// checkAlerts prices every symbol with an active alert and fires the alerts
+// whose threshold has been crossed.
+func checkAlerts(ctx context.Context) error {
+	symbols, err := alertsCollection().Distinct(ctx, "symbol", bson.M{"active": true})
+	if err != nil {
+		return err
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for range min(alertPollWorkers, len(symbols)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sym := range work {
+				checkSymbolAlerts(ctx, sym)
+			}
+		}()
+	}
+	for _, s := range symbols {
+		if sym, ok := s.(string); ok {
+			work <- sym
+		}
+	}
+	close(work)
+	wg.Wait()
+	return nil
+}
+
+// checkSymbolAlerts fires symbol's alerts that its live price has crossed.
+// Alerts never fire on a cached price; if no fresh quote can be had the
+// symbol is skipped until the next tick.
+func checkSymbolAlerts(ctx context.Context, symbol string) {
+	quote, err := fetchLiveStock(ctx, symbol)
+	if err != nil {
+		log.Printf("price alerts: failed to price %s, skipping: %v", symbol, err)
+		return
+	}
+
+	cursor, err := alertsCollection().Find(ctx, bson.M{"symbol": symbol, "active": true})
+	if err != nil {
+		log.Printf("price alerts: failed to load alerts for %s: %v", symbol, err)
+		return
+	}
+	var alerts []AlertDoc
+	if err := cursor.All(ctx, &alerts); err != nil {
+		log.Printf("price alerts: failed to decode alerts for %s: %v", symbol, err)
+		return
+	}
+
+	for i := range alerts {
+		if alerts[i].crossed(quote.Price) {
+			fireAlert(ctx, &alerts[i], quote)
+		}
+	}
+}
+
+// fireAlert deactivates an alert and tells its owner. The conditional update
+// makes sure only one server instance delivers it.
+func fireAlert(ctx context.Context, alert *AlertDoc, quote *StockResponse) {
+	now := time.Now()
+	res, err := alertsCollection().UpdateOne(ctx,
+		bson.M{"alertId": alert.AlertID, "userId": alert.UserID, "active": true},
+		bson.M{"$set": bson.M{"active": false, "triggeredAt": now, "triggerPrice": quote.Price}},
+	)
+	if err != nil {
+		log.Printf("price alerts: failed to mark alert %s triggered: %v", alert.AlertID, err)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		return
+	}
+
+	body := fmt.Sprintf("🔔 **%s** is %s $%.2f — now $%.2f (alert `%s`)",
+		alert.Symbol, alert.Direction, alert.Threshold, quote.Price, alert.AlertID)
+	payload, err := hub.NewPayload(hub.PayloadQuote, QuotePayload(*quote))
+	if err != nil {
+		log.Printf("failed to encode %s payload: %v", hub.PayloadQuote, err)
+	}
+	NotifyUser(ctx, alert.UserID, body, payload)
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "alert",
+		Args: []CommandArg{
+			{Name: "SYMBOL", Required: true},
+			{Name: "above|below", Required: true},
+			{Name: "PRICE"},
+		},
+		Description: "Get a message when a price crosses a threshold; `/alert rm ID` cancels one",
+		Example:     "/alert AAPL above 200",
+		Handler:     HandleAlertCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "alerts",
+		Description: "List your active price alerts",
+		Handler:     HandleAlertsCommand,
+	})
+}
+
+// HandleAlertCommand creates a price alert, or cancels one with "rm ID"
+func HandleAlertCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	if strings.EqualFold(args[0], "rm") {
+		if len(args) != 2 {
+			return []BotResponse{{From: "bot", Body: "Usage: `/alert rm ID` (see `/alerts` for IDs)"}}
+		}
+		switch err := CancelAlert(ctx, in.From, args[1]); {
+		case errors.Is(err, ErrAlertNotFound):
+			return []BotResponse{{From: "bot", Body: fmt.Sprintf("No active alert `%s`. Type `/alerts` to see yours.", args[1])}}
+		case err != nil:
+			log.Printf("failed to cancel alert %s for %s: %v", args[1], in.From, err)
+			return []BotResponse{{From: "bot", Body: "Couldn't cancel that alert. Try again in a moment!"}}
+		}
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("🗑️ Alert `%s` cancelled.", strings.ToLower(args[1]))}}
+	}
+
+	cmd, _ := Commands.Lookup("alert")
+	if len(args) != 3 {
+		return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+	}
+	sym, err := ParseSymbol(args[0])
+	if err != nil {
+		return invalidSymbolReply(args[0])
+	}
+	direction := strings.ToLower(args[1])
+	threshold, err := strconv.ParseFloat(strings.TrimPrefix(args[2], "$"), 64)
+	if (direction != AlertAbove && direction != AlertBelow) || err != nil ||
+		math.IsNaN(threshold) || math.IsInf(threshold, 0) || threshold <= 0 {
+		return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+	}
+
+	alert, err := CreateAlert(ctx, in.From, sym, direction, threshold)
+	switch {
+	case errors.Is(err, ErrTooManyAlerts):
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("You already have %d active alerts. Cancel one with `/alert rm ID` first.", maxAlertsPerUser)}}
+	case err != nil:
+		log.Printf("failed to create alert for %s: %v", in.From, err)
+		return []BotResponse{{From: "bot", Body: "Couldn't save that alert. Try again in a moment!"}}
+	}
+	return []BotResponse{{From: "bot", Body: fmt.Sprintf("🔔 Alert `%s` set: I'll message you when **%s** is %s $%.2f.",
+		alert.AlertID, alert.Symbol, alert.Direction, alert.Threshold)}}
+}
+
+// HandleAlertsCommand lists the sender's active price alerts
+func HandleAlertsCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	alerts, err := LoadUserAlerts(ctx, in.From)
+	if err != nil {
+		log.Printf("failed to load alerts for %s: %v", in.From, err)
+		return []BotResponse{{From: "bot", Body: "Couldn't load your alerts. Try again in a moment!"}}
+	}
+	if len(alerts) == 0 {
+		return []BotResponse{{From: "bot", Body: "You have no active alerts. Try `/alert AAPL above 200`."}}
+	}
+
+	lines := []string{"🔔 **Your Alerts:**", ""}
+	table := TablePayload{Title: "Your Alerts", Columns: []string{"ID", "Symbol", "Condition"}}
+	for _, a := range alerts {
+		cond := fmt.Sprintf("%s $%.2f", a.Direction, a.Threshold)
+		lines = append(lines, fmt.Sprintf("• `%s` **%s** %s", a.AlertID, a.Symbol, cond))
+		table.Rows = append(table.Rows, []string{a.AlertID, a.Symbol, cond})
+	}
+	lines = append(lines, "", "Cancel one with `/alert rm ID`.")
+	return botReply(strings.Join(lines, "\n"), hub.PayloadTable, table)
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+// Every case is rejected before the alert store is touched.
+func TestHandleAlertCommandRejectsThreshold(t *testing.T) {
+	for _, threshold := range []string{"0", "-5", "abc", "NaN", "nan", "Inf", "+Inf", "-Inf", "1e309", "$NaN"} {
+		t.Run(threshold, func(t *testing.T) {
+			got := HandleAlertCommand(context.Background(), &hub.Message{From: "alice"}, []string{"AAPL", "above", threshold})
+			if len(got) != 1 || !strings.HasPrefix(got[0].Body, "Usage:") {
+				t.Errorf("threshold %q got %v; want a usage reply", threshold, got)
+			}
+		})
+	}
+}
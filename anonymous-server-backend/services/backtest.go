@@ -0,0 +1,377 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+const (
+	// StrategyEMA goes long while the fast EMA is above the slow EMA.
+	StrategyEMA = "ema"
+	// StrategyEMSTD buys when price falls k exponential standard deviations
+	// below its EMA and sells once it reverts to the EMA.
+	StrategyEMSTD = "emstd"
+
+	// tradingDays annualizes daily Sharpe ratios.
+	tradingDays = 252
+	// minSpan is the shortest EMA span; below it the smoothing factor
+	// exceeds 1 and the average overshoots every price.
+	minSpan = 1
+	// maxSweepRuns caps how many parameter combinations one /backtest runs.
+	maxSweepRuns = 50
+	// sweepSteps is how many values an unstepped range like "5..20" expands to.
+	sweepSteps = 4
+	// minBacktestBars is the shortest price history worth testing.
+	minBacktestBars = 30
+	// backtestRows is how many sweep results the reply shows.
+	backtestRows = 10
+	// defaultBacktestPeriod is the history used when none is given.
+	defaultBacktestPeriod = "1y"
+)
+
+var (
+	// ErrBadStrategyParams is returned for malformed or out-of-range sweep parameters.
+	ErrBadStrategyParams = errors.New("invalid strategy parameters")
+	// ErrSweepTooLarge is returned when a sweep expands to more than maxSweepRuns runs.
+	ErrSweepTooLarge = errors.New("parameter sweep too large")
+	// ErrNotEnoughHistory is returned when there are too few bars to backtest.
+	ErrNotEnoughHistory = errors.New("not enough price history")
+)
+
+// BacktestResult summarizes one strategy run over a price series.
+type BacktestResult struct {
+	Strategy    string
+	Params      []float64
+	Return      float64 // total return, 0.10 = +10%
+	Sharpe      float64 // annualized, zero risk-free rate
+	MaxDrawdown float64 // largest peak-to-trough equity loss, 0.25 = -25%
+	Trades      int     // number of entries
+}
+
+// Label renders the strategy and parameters, e.g. "ema 10/50".
+func (r *BacktestResult) Label() string {
+	parts := make([]string, len(r.Params))
+	for i, p := range r.Params {
+		parts[i] = strconv.FormatFloat(p, 'f', -1, 64)
+	}
+	return r.Strategy + " " + strings.Join(parts, "/")
+}
+
+// ema returns the exponential moving average of closes with the given span.
+func ema(closes []float64, span float64) []float64 {
+	out := make([]float64, len(closes))
+	alpha := 2 / (span + 1)
+	for i, c := range closes {
+		if i == 0 {
+			out[i] = c
+			continue
+		}
+		out[i] = alpha*c + (1-alpha)*out[i-1]
+	}
+	return out
+}
+
+// emstd returns the EMA of closes and the exponentially weighted standard
+// deviation around it, both with the given span.
+func emstd(closes []float64, span float64) (mean, std []float64) {
+	mean = make([]float64, len(closes))
+	std = make([]float64, len(closes))
+	alpha := 2 / (span + 1)
+	variance := 0.0
+	for i, c := range closes {
+		if i == 0 {
+			mean[i] = c
+			continue
+		}
+		diff := c - mean[i-1]
+		mean[i] = mean[i-1] + alpha*diff
+		variance = (1 - alpha) * (variance + alpha*diff*diff)
+		std[i] = math.Sqrt(variance)
+	}
+	return mean, std
+}
+
+// emaCrossSignals is long (true) on bars where the fast EMA is above the slow one.
+func emaCrossSignals(closes []float64, fast, slow float64) []bool {
+	f, s := ema(closes, fast), ema(closes, slow)
+	long := make([]bool, len(closes))
+	for i := range closes {
+		long[i] = f[i] > s[i]
+	}
+	return long
+}
+
+// bandSignals enters below mean-k·std and holds until price is back at the mean.
+func bandSignals(closes []float64, span, k float64) []bool {
+	mean, std := emstd(closes, span)
+	long := make([]bool, len(closes))
+	holding := false
+	for i, c := range closes {
+		switch {
+		case !holding && std[i] > 0 && c < mean[i]-k*std[i]:
+			holding = true
+		case holding && c >= mean[i]:
+			holding = false
+		}
+		long[i] = holding
+	}
+	return long
+}
+
+// evaluate scores a long/flat signal series. The position decided at bar i's
+// close earns the return from bar i to i+1, so there is no lookahead.
+func evaluate(closes []float64, long []bool) (ret, sharpe, maxDD float64, trades int) {
+	equity, peak := 1.0, 1.0
+	var sum, sumSq float64
+	n := len(closes) - 1
+	for i := 0; i < n; i++ {
+		if long[i] && (i == 0 || !long[i-1]) {
+			trades++
+		}
+		r := 0.0
+		if long[i] && closes[i] != 0 {
+			r = closes[i+1]/closes[i] - 1
+		}
+		equity *= 1 + r
+		peak = math.Max(peak, equity)
+		maxDD = math.Max(maxDD, 1-equity/peak)
+		sum += r
+		sumSq += r * r
+	}
+	if n > 1 {
+		mean := sum / float64(n)
+		variance := (sumSq - float64(n)*mean*mean) / float64(n-1)
+		if variance > 0 {
+			sharpe = mean / math.Sqrt(variance) * math.Sqrt(tradingDays)
+		}
+	}
+	return equity - 1, sharpe, maxDD, trades
+}
+
+// parseSweep expands a parameter spec such as "10,50", "5..20,50..100" or
+// "20,1.5..2.5:0.5" into every combination to run. Each comma-separated
+// dimension is a value, a range split into sweepSteps values, or a range
+// with an explicit ":step".
+func parseSweep(spec string, dims int) ([][]float64, error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) != dims {
+		return nil, ErrBadStrategyParams
+	}
+	combos := [][]float64{{}}
+	for _, part := range parts {
+		values, err := parseRange(part)
+		if err != nil {
+			return nil, err
+		}
+		if len(combos)*len(values) > maxSweepRuns {
+			return nil, ErrSweepTooLarge
+		}
+		next := make([][]float64, 0, len(combos)*len(values))
+		for _, c := range combos {
+			for _, v := range values {
+				next = append(next, append(append([]float64{}, c...), v))
+			}
+		}
+		combos = next
+	}
+	return combos, nil
+}
+
+// parseRange expands one sweep dimension, see parseSweep. Ranges are split on
+// "..", which unlike "-" cannot appear inside a number such as 1e-3.
+func parseRange(s string) ([]float64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(s, ":")
+	lo, hi, isRange := strings.Cut(rangePart, "..")
+	start, err := parseParam(lo)
+	if err != nil {
+		return nil, err
+	}
+	if !isRange {
+		if hasStep {
+			return nil, ErrBadStrategyParams
+		}
+		return []float64{start}, nil
+	}
+	end, err := parseParam(hi)
+	if err != nil || end < start {
+		return nil, ErrBadStrategyParams
+	}
+
+	step := (end - start) / (sweepSteps - 1)
+	if hasStep {
+		if step, err = strconv.ParseFloat(stepPart, 64); err != nil || step <= 0 || math.IsInf(step, 0) {
+			return nil, ErrBadStrategyParams
+		}
+	}
+	if step == 0 {
+		return []float64{start}, nil
+	}
+	var values []float64
+	for v := start; v <= end+step/1e6; v += step {
+		if len(values) == maxSweepRuns {
+			return nil, ErrSweepTooLarge
+		}
+		values = append(values, math.Round(v*100)/100)
+	}
+	return values, nil
+}
+
+// parseParam reads one strategy parameter. Every parameter is a span or a
+// band width, so it must be finite and positive.
+func parseParam(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || v <= 0 {
+		return 0, ErrBadStrategyParams
+	}
+	return v, nil
+}
+
+// RunBacktest sweeps strategy over every parameter combination in spec and
+// returns the results sorted by Sharpe ratio, best first.
+func RunBacktest(closes []float64, strategy, spec string) ([]BacktestResult, error) {
+	if len(closes) < minBacktestBars {
+		return nil, ErrNotEnoughHistory
+	}
+	combos, err := parseSweep(spec, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BacktestResult, 0, len(combos))
+	for _, p := range combos {
+		var long []bool
+		switch strategy {
+		case StrategyEMA:
+			if p[0] < minSpan {
+				return nil, ErrBadStrategyParams
+			}
+			if p[0] >= p[1] {
+				continue // fast must be faster than slow
+			}
+			long = emaCrossSignals(closes, p[0], p[1])
+		case StrategyEMSTD:
+			if p[0] < minSpan {
+				return nil, ErrBadStrategyParams
+			}
+			long = bandSignals(closes, p[0], p[1])
+		default:
+			return nil, ErrBadStrategyParams
+		}
+		r := BacktestResult{Strategy: strategy, Params: p}
+		r.Return, r.Sharpe, r.MaxDrawdown, r.Trades = evaluate(closes, long)
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return nil, ErrBadStrategyParams
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Sharpe > results[j].Sharpe })
+	return results, nil
+}
+
+// isIntradayPeriod reports whether the finance API charts period with hourly
+// rather than daily bars.
+func isIntradayPeriod(period string) bool {
+	return period == "1d" || period == "5d"
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "backtest",
+		Args: []CommandArg{
+			{Name: "SYMBOL", Required: true},
+			{Name: "ema|emstd", Required: true},
+			{Name: "PARAMS", Required: true},
+			{Name: "OPTIONS", Variadic: true},
+		},
+		Description: "Strategy Lab: backtest EMA crossovers (FAST,SLOW) or EMA±k·std bands (SPAN,K); " +
+			"ranges like `5..20` or `1..3:0.5` sweep, and `period 2y` sets the daily-bar history",
+		Example: "/backtest AAPL ema 10,50 period 1y",
+		Handler: HandleBacktestCommand,
+	})
+}
+
+// HandleBacktestCommand runs a Strategy Lab parameter sweep
+func HandleBacktestCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	cmd, _ := Commands.Lookup("backtest")
+	strategy, spec := strings.ToLower(args[1]), args[2]
+	sym, err := ParseSymbol(args[0])
+	if err != nil {
+		return invalidSymbolReply(args[0])
+	}
+
+	period := defaultBacktestPeriod
+	switch opts := args[3:]; {
+	case len(opts) == 2 && strings.EqualFold(opts[0], "period"):
+		if period, err = ParsePeriod(opts[1]); err != nil {
+			return invalidPeriodReply(opts[1])
+		}
+		if isIntradayPeriod(period) {
+			// Sharpe is annualized by trading days, so bars must be daily.
+			return []BotResponse{{From: "bot", Body: fmt.Sprintf(
+				"Backtests run on daily bars, and `%s` charts are hourly. Use `1mo` or longer.", period)}}
+		}
+	case len(opts) != 0:
+		return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+	}
+	if strategy != StrategyEMA && strategy != StrategyEMSTD {
+		return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+	}
+
+	var chart ChartPayload
+	if err := financeGetJSON(ctx, chartPath(sym, period), &chart); err != nil {
+		return []BotResponse{{From: "bot", Body: friendlyError(sym, err)}}
+	}
+	closes := make([]float64, len(chart.Points))
+	for i, p := range chart.Points {
+		closes[i] = p.Close
+	}
+
+	results, err := RunBacktest(closes, strategy, spec)
+	switch {
+	case errors.Is(err, ErrNotEnoughHistory):
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("Only %d bars of **%s** history for %s — try a longer period.", len(closes), sym, period)}}
+	case errors.Is(err, ErrSweepTooLarge):
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("That sweep is too big; keep it to %d combinations.", maxSweepRuns)}}
+	case err != nil:
+		return []BotResponse{{From: "bot", Body: usageReply(cmd) + " EMA needs FAST,SLOW with FAST < SLOW; emstd needs SPAN,K."}}
+	}
+
+	hold := 0.0
+	if closes[0] != 0 {
+		hold = closes[len(closes)-1]/closes[0] - 1
+	}
+	lines := []string{
+		fmt.Sprintf("🧪 **Strategy Lab: %s** (%s, %d bars)", sym, period, len(closes)),
+		fmt.Sprintf("Buy & hold: %+.1f%%", hold*100),
+		"",
+	}
+	table := TablePayload{
+		Title:   fmt.Sprintf("Strategy Lab: %s %s", sym, period),
+		Columns: []string{"Strategy", "Return", "Sharpe", "Max DD", "Trades"},
+	}
+	for i, r := range results {
+		if i == backtestRows {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%d. `%s`  %+.1f%%  Sharpe %.2f  MaxDD -%.1f%%  %d trades",
+			i+1, r.Label(), r.Return*100, r.Sharpe, r.MaxDrawdown*100, r.Trades))
+		table.Rows = append(table.Rows, []string{
+			r.Label(),
+			fmt.Sprintf("%+.2f%%", r.Return*100),
+			fmt.Sprintf("%.2f", r.Sharpe),
+			fmt.Sprintf("-%.2f%%", r.MaxDrawdown*100),
+			strconv.Itoa(r.Trades),
+		})
+	}
+	if len(results) > backtestRows {
+		lines = append(lines, fmt.Sprintf("…and %d more runs", len(results)-backtestRows))
+	}
+	return botReply(strings.Join(lines, "\n"), hub.PayloadTable, table)
+}
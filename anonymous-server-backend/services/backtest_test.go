@@ -0,0 +1,235 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func approxEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEMA(t *testing.T) {
+	tests := []struct {
+		name   string
+		closes []float64
+		span   float64
+		want   []float64
+	}{
+		{name: "empty", closes: nil, span: 3, want: []float64{}},
+		{name: "span 3", closes: []float64{1, 2, 3}, span: 3, want: []float64{1, 1.5, 2.25}},
+		{name: "span 1 tracks price", closes: []float64{4, 7, 1}, span: 1, want: []float64{4, 7, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ema(tt.closes, tt.span); !approxEqual(got, tt.want) {
+				t.Errorf("ema(%v, %v) = %v; want %v", tt.closes, tt.span, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEMSTD(t *testing.T) {
+	tests := []struct {
+		name     string
+		closes   []float64
+		span     float64
+		wantMean []float64
+		wantStd  []float64
+	}{
+		{name: "flat", closes: []float64{5, 5, 5}, span: 3, wantMean: []float64{5, 5, 5}, wantStd: []float64{0, 0, 0}},
+		{name: "one move", closes: []float64{1, 3}, span: 3, wantMean: []float64{1, 2}, wantStd: []float64{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, std := emstd(tt.closes, tt.span)
+			if !approxEqual(mean, tt.wantMean) || !approxEqual(std, tt.wantStd) {
+				t.Errorf("emstd(%v, %v) = %v, %v; want %v, %v", tt.closes, tt.span, mean, std, tt.wantMean, tt.wantStd)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name       string
+		closes     []float64
+		long       []bool
+		wantReturn float64
+		wantSharpe float64
+		wantMaxDD  float64
+		wantTrades int
+	}{
+		{name: "always flat", closes: []float64{100, 120, 80}, long: []bool{false, false, false}},
+		{
+			name:       "round trip loses",
+			closes:     []float64{100, 110, 99},
+			long:       []bool{true, true, false},
+			wantReturn: -0.01,
+			wantMaxDD:  0.1,
+			wantTrades: 1,
+		},
+		{
+			// The last bar's signal has no next bar to earn from.
+			name:       "no lookahead",
+			closes:     []float64{100, 110, 121},
+			long:       []bool{true, false, true},
+			wantReturn: 0.1,
+			wantSharpe: 0.05 / math.Sqrt(0.005) * math.Sqrt(tradingDays),
+			wantTrades: 1,
+		},
+		{
+			name:       "two entries",
+			closes:     []float64{100, 100, 100, 100, 100},
+			long:       []bool{true, false, true, true, false},
+			wantTrades: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ret, sharpe, maxDD, trades := evaluate(tt.closes, tt.long)
+			got := []float64{ret, sharpe, maxDD}
+			want := []float64{tt.wantReturn, tt.wantSharpe, tt.wantMaxDD}
+			if !approxEqual(got, want) || trades != tt.wantTrades {
+				t.Errorf("evaluate() = %v, %d trades; want %v, %d trades", got, trades, want, tt.wantTrades)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []float64
+		wantErr error
+	}{
+		{in: "10", want: []float64{10}},
+		{in: "1.5", want: []float64{1.5}},
+		{in: "1e-3", want: []float64{0.001}},
+		{in: "5..20", want: []float64{5, 10, 15, 20}},
+		{in: "1..3:0.5", want: []float64{1, 1.5, 2, 2.5, 3}},
+		{in: "5..5", want: []float64{5}},
+		{in: "", wantErr: ErrBadStrategyParams},
+		{in: "abc", wantErr: ErrBadStrategyParams},
+		{in: "0", wantErr: ErrBadStrategyParams},
+		{in: "-5", wantErr: ErrBadStrategyParams},
+		{in: "NaN", wantErr: ErrBadStrategyParams},
+		{in: "Inf", wantErr: ErrBadStrategyParams},
+		{in: "1..Inf", wantErr: ErrBadStrategyParams},
+		{in: "5-20", wantErr: ErrBadStrategyParams},
+		{in: "20..5", wantErr: ErrBadStrategyParams},
+		{in: "5:1", wantErr: ErrBadStrategyParams},
+		{in: "1..2:0", wantErr: ErrBadStrategyParams},
+		{in: "1..2:Inf", wantErr: ErrBadStrategyParams},
+		{in: "1..1000:1", wantErr: ErrSweepTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseRange(tt.in)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseRange(%q) error = %v; want %v", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !approxEqual(got, tt.want) {
+				t.Errorf("parseRange(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSweep(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    [][]float64
+		wantErr error
+	}{
+		{spec: "10,50", want: [][]float64{{10, 50}}},
+		{spec: "5..10:5,20..30:10", want: [][]float64{{5, 20}, {5, 30}, {10, 20}, {10, 30}}},
+		{spec: "10", wantErr: ErrBadStrategyParams},
+		{spec: "10,20,30", wantErr: ErrBadStrategyParams},
+		{spec: "10,x", wantErr: ErrBadStrategyParams},
+		{spec: "1..10:1,1..10:1", wantErr: ErrSweepTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseSweep(tt.spec, 2)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseSweep(%q) error = %v; want %v", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSweep(%q) = %v, %v; want %v", tt.spec, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunBacktest(t *testing.T) {
+	closes := make([]float64, 120)
+	for i := range closes {
+		closes[i] = 100 + 10*math.Sin(float64(i)/8) + float64(i)/4
+	}
+
+	tests := []struct {
+		name     string
+		closes   []float64
+		strategy string
+		spec     string
+		wantRuns int
+		wantErr  error
+	}{
+		{name: "ema sweep", closes: closes, strategy: StrategyEMA, spec: "5..10:5,20..40:20", wantRuns: 4},
+		{name: "fast must beat slow", closes: closes, strategy: StrategyEMA, spec: "10..30:10,20", wantRuns: 1},
+		{name: "emstd sweep", closes: closes, strategy: StrategyEMSTD, spec: "20,1..2:0.5", wantRuns: 3},
+		{name: "too little history", closes: closes[:minBacktestBars-1], strategy: StrategyEMA, spec: "5,20", wantErr: ErrNotEnoughHistory},
+		{name: "ema span below 1", closes: closes, strategy: StrategyEMA, spec: "0.5,20", wantErr: ErrBadStrategyParams},
+		{name: "emstd span below 1", closes: closes, strategy: StrategyEMSTD, spec: "0.5,2", wantErr: ErrBadStrategyParams},
+		{name: "no valid ema pair", closes: closes, strategy: StrategyEMA, spec: "50,10", wantErr: ErrBadStrategyParams},
+		{name: "unknown strategy", closes: closes, strategy: "rsi", spec: "5,20", wantErr: ErrBadStrategyParams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := RunBacktest(tt.closes, tt.strategy, tt.spec)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RunBacktest() error = %v; want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunBacktest() error = %v", err)
+			}
+			if len(results) != tt.wantRuns {
+				t.Fatalf("got %d runs; want %d", len(results), tt.wantRuns)
+			}
+			for i := 1; i < len(results); i++ {
+				if results[i].Sharpe > results[i-1].Sharpe {
+					t.Errorf("results not sorted by Sharpe: %v", results)
+				}
+			}
+		})
+	}
+}
+
+func TestIsIntradayPeriod(t *testing.T) {
+	for _, p := range chartPeriods {
+		want := p == "1d" || p == "5d"
+		if got := isIntradayPeriod(p); got != want {
+			t.Errorf("isIntradayPeriod(%q) = %v; want %v", p, got, want)
+		}
+	}
+}
@@ -2,13 +2,36 @@ package services
 
 import (
 	"context"
+	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/zelshahawy/Anonymous_backend/config"
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNotMessageAuthor is returned when a user edits or deletes someone else's message.
+var ErrNotMessageAuthor = errors.New("only the author can change this message")
+
+// ErrDuplicateMessage is returned when a sender reuses a message nonce.
+var ErrDuplicateMessage = errors.New("duplicate message nonce")
+
+// ErrEmptyMessage is returned when a message body is blank.
+var ErrEmptyMessage = errors.New("message body is required")
+
+// ErrMessageDeleted is returned when editing a message that was already deleted.
+var ErrMessageDeleted = errors.New("message has been deleted")
+
+// MessageEdit keeps a previous body of an edited message.
+type MessageEdit struct {
+	Body     string    `bson:"body"`
+	EditedAt time.Time `bson:"editedAt"`
+}
+
 // MessageDoc represents a chat message stored in MongoDB.
 type MessageDoc struct {
 	MsgID     string    `bson:"msgId"`
@@ -18,15 +41,106 @@ type MessageDoc struct {
 	Type      string    `bson:"type, omitempty"` // Add this field
 	Notified  bool      `bson:"notified"`
 	Timestamp time.Time `bson:"timestamp"`
+	Receipts  []Receipt `bson:"receipts,omitempty"`
+	// Edits holds earlier bodies, oldest first. Deleted messages keep only a tombstone.
+	Edits     []MessageEdit `bson:"edits,omitempty"`
+	EditedAt  *time.Time    `bson:"editedAt,omitempty"`
+	Deleted   bool          `bson:"deleted,omitempty"`
+	DeletedAt *time.Time    `bson:"deletedAt,omitempty"`
+	// Nonce is the sender's idempotency key; unique per sender when present.
+	Nonce string `bson:"nonce,omitempty"`
+	// Payload is structured content for bot replies, see hub.Payload.
+	Payload *hub.Payload `bson:"payload,omitempty"`
 }
 
-// SaveMessage persists a MessageDoc to the messages collection.
+// SaveMessage persists a MessageDoc to the messages collection. It returns
+// ErrDuplicateMessage if the sender already stored a message with doc's nonce.
 func SaveMessage(ctx context.Context, doc *MessageDoc) error {
 	doc.Timestamp = time.Now()
 	_, err := config.DBClients.MessagesCollection.InsertOne(ctx, doc)
+	if doc.Nonce != "" && mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateMessage
+	}
 	return err
 }
 
+// FindMessageByNonce looks up the message a sender stored with the given nonce.
+func FindMessageByNonce(ctx context.Context, from, nonce string) (*MessageDoc, error) {
+	var doc MessageDoc
+	err := config.DBClients.MessagesCollection.FindOne(ctx, bson.M{"from": from, "nonce": nonce}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// findAuthoredChat loads a chat message and checks that userID wrote it.
+func findAuthoredChat(ctx context.Context, msgID, userID string) (*MessageDoc, error) {
+	doc, err := FindMessage(ctx, msgID)
+	if err != nil {
+		return nil, err
+	}
+	if doc.From != userID || (doc.Type != "" && doc.Type != "chat") {
+		return nil, ErrNotMessageAuthor
+	}
+	if doc.Deleted {
+		return nil, ErrMessageDeleted
+	}
+	return doc, nil
+}
+
+// EditMessage replaces the body of a chat message, keeping the previous body
+// in its edit history. Only the original author may edit.
+func EditMessage(ctx context.Context, msgID, userID, body string) (*MessageDoc, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, ErrEmptyMessage
+	}
+	doc, err := findAuthoredChat(ctx, msgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var updated MessageDoc
+	err = config.DBClients.MessagesCollection.FindOneAndUpdate(ctx,
+		bson.M{"msgId": msgID, "deleted": bson.M{"$ne": true}},
+		bson.M{
+			"$set":  bson.M{"body": body, "editedAt": now},
+			"$push": bson.M{"edits": MessageEdit{Body: doc.Body, EditedAt: now}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteMessage replaces a chat message with a tombstone, discarding its body
+// and edit history. Only the original author may delete.
+func DeleteMessage(ctx context.Context, msgID, userID string) (*MessageDoc, error) {
+	if _, err := findAuthoredChat(ctx, msgID, userID); err != nil {
+		return nil, err
+	}
+
+	var updated MessageDoc
+	err := config.DBClients.MessagesCollection.FindOneAndUpdate(ctx,
+		bson.M{"msgId": msgID},
+		bson.M{
+			"$set":   bson.M{"body": "", "deleted": true, "deletedAt": time.Now()},
+			"$unset": bson.M{"edits": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
 func DeleteUserData(username string) error {
 	// remove all messages sent or received by this user
 	filter := bson.M{"$or": []bson.M{
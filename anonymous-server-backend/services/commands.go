@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+// CommandHandler answers a bot command. args are the words after the command
+// name and have already been checked against the command's Args.
+type CommandHandler func(ctx context.Context, in *hub.Message, args []string) []BotResponse
+
+// CommandArg describes one positional argument of a bot command.
+type CommandArg struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	// Variadic marks a final argument that accepts any number of words.
+	Variadic bool `json:"variadic,omitempty"`
+}
+
+// Command is a bot command that can be registered with a CommandRegistry.
+type Command struct {
+	Name        string         `json:"name"`
+	Aliases     []string       `json:"aliases,omitempty"`
+	Args        []CommandArg   `json:"args,omitempty"`
+	Description string         `json:"description"`
+	Example     string         `json:"example,omitempty"`
+	Handler     CommandHandler `json:"-"`
+}
+
+// Usage renders the command with its argument spec, e.g. "/chart SYMBOL [PERIOD]".
+func (c *Command) Usage() string {
+	parts := []string{"/" + c.Name}
+	for _, a := range c.Args {
+		name := a.Name
+		if a.Variadic {
+			name += "..."
+		}
+		if !a.Required {
+			name = "[" + name + "]"
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, " ")
+}
+
+// acceptsArgs reports whether n arguments satisfy the command's spec.
+func (c *Command) acceptsArgs(n int) bool {
+	required := 0
+	for _, a := range c.Args {
+		if a.Required {
+			required++
+		}
+	}
+	if n < required {
+		return false
+	}
+	if len(c.Args) > 0 && c.Args[len(c.Args)-1].Variadic {
+		return true
+	}
+	return n <= len(c.Args)
+}
+
+// CommandRegistry dispatches bot commands by name or alias.
+type CommandRegistry interface {
+	// Register adds a command, replacing any command with the same name.
+	Register(cmd Command)
+	// Lookup finds a command by name or alias, without the leading slash.
+	Lookup(name string) (*Command, bool)
+	// Commands lists every registered command sorted by name.
+	Commands() []Command
+	// Dispatch runs the command in the message body, if there is one.
+	Dispatch(ctx context.Context, in *hub.Message) []BotResponse
+}
+
+type commandRegistry struct {
+	mu      sync.RWMutex
+	byName  map[string]*Command
+	aliases map[string]string
+}
+
+// NewCommandRegistry returns an empty registry.
+func NewCommandRegistry() CommandRegistry {
+	return &commandRegistry{
+		byName:  make(map[string]*Command),
+		aliases: make(map[string]string),
+	}
+}
+
+// Commands is the registry the chat bot dispatches through.
+var Commands = NewCommandRegistry()
+
+// RegisterCommand adds a command to the default registry.
+func RegisterCommand(cmd Command) {
+	Commands.Register(cmd)
+}
+
+func (r *commandRegistry) Register(cmd Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := strings.ToLower(cmd.Name)
+	r.byName[name] = &cmd
+	for _, alias := range cmd.Aliases {
+		r.aliases[strings.ToLower(alias)] = name
+	}
+}
+
+func (r *commandRegistry) Lookup(name string) (*Command, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name = strings.ToLower(name)
+	if target, ok := r.aliases[name]; ok {
+		name = target
+	}
+	cmd, ok := r.byName[name]
+	return cmd, ok
+}
+
+func (r *commandRegistry) Commands() []Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]Command, 0, len(r.byName))
+	for _, cmd := range r.byName {
+		out = append(out, *cmd)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (r *commandRegistry) Dispatch(ctx context.Context, in *hub.Message) []BotResponse {
+	parts := strings.Fields(in.Body)
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "/") || len(parts[0]) == 1 {
+		return nil
+	}
+	name, args := strings.TrimPrefix(parts[0], "/"), parts[1:]
+
+	if strings.EqualFold(name, "help") {
+		return []BotResponse{{From: "bot", Body: r.help(args)}}
+	}
+
+	cmd, ok := r.Lookup(name)
+	if !ok {
+		return []BotResponse{{From: "bot", Body: r.unknown(name)}}
+	}
+	if !cmd.acceptsArgs(len(args)) {
+		return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+	}
+	return cmd.Handler(ctx, in, args)
+}
+
+// usageReply explains how to call a command that got the wrong arguments.
+func usageReply(cmd *Command) string {
+	text := fmt.Sprintf("Usage: `%s`", cmd.Usage())
+	if cmd.Example != "" {
+		text += fmt.Sprintf(" (e.g. `%s`)", cmd.Example)
+	}
+	return text
+}
+
+// help renders the /help reply, either for one command or for all of them.
+func (r *commandRegistry) help(args []string) string {
+	if len(args) > 0 {
+		name := strings.TrimPrefix(args[0], "/")
+		cmd, ok := r.Lookup(name)
+		if !ok {
+			return r.unknown(name)
+		}
+		lines := []string{fmt.Sprintf("**%s**", cmd.Usage()), cmd.Description}
+		if len(cmd.Aliases) > 0 {
+			lines = append(lines, "Aliases: /"+strings.Join(cmd.Aliases, ", /"))
+		}
+		if cmd.Example != "" {
+			lines = append(lines, fmt.Sprintf("Example: `%s`", cmd.Example))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	lines := []string{"🤖 **Bot Commands:**", ""}
+	for _, cmd := range r.Commands() {
+		lines = append(lines, fmt.Sprintf("• `%s` — %s", cmd.Usage(), cmd.Description))
+	}
+	lines = append(lines, "", "Type `/help COMMAND` for details.")
+	return strings.Join(lines, "\n")
+}
+
+// unknown replies to an unrecognised command, suggesting close matches.
+func (r *commandRegistry) unknown(name string) string {
+	text := fmt.Sprintf("Unknown command `/%s`.", name)
+	if s := r.suggest(name); len(s) > 0 {
+		text += " Did you mean `/" + strings.Join(s, "`, `/") + "`?"
+	}
+	return text + " Type `/help` to see every command."
+}
+
+// suggest returns registered names and aliases that are a prefix match or
+// within a small edit distance of name.
+func (r *commandRegistry) suggest(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name = strings.ToLower(name)
+	candidates := make([]string, 0, len(r.byName)+len(r.aliases))
+	for n := range r.byName {
+		candidates = append(candidates, n)
+	}
+	for a := range r.aliases {
+		candidates = append(candidates, a)
+	}
+	sort.Strings(candidates)
+
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, name) || editDistance(name, c) <= 2 {
+			out = append(out, c)
+		}
+		if len(out) == 3 {
+			break
+		}
+	}
+	return out
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+// echoHandler replies with the arguments it was called with.
+func echoHandler(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	return []BotResponse{{From: "bot", Body: "args: " + strings.Join(args, " ")}}
+}
+
+func newTestRegistry() CommandRegistry {
+	r := NewCommandRegistry()
+	r.Register(Command{
+		Name:    "quote",
+		Aliases: []string{"q", "price"},
+		Args:    []CommandArg{{Name: "SYMBOL", Required: true}},
+		Example: "/quote AAPL",
+		Handler: echoHandler,
+	})
+	r.Register(Command{
+		Name:    "chart",
+		Args:    []CommandArg{{Name: "SYMBOL", Required: true}, {Name: "PERIOD"}},
+		Handler: echoHandler,
+	})
+	r.Register(Command{
+		Name:    "compare",
+		Args:    []CommandArg{{Name: "SYMBOLS", Required: true, Variadic: true}},
+		Handler: echoHandler,
+	})
+	r.Register(Command{Name: "news", Handler: echoHandler})
+	return r
+}
+
+func TestCommandRegistryLookup(t *testing.T) {
+	r := newTestRegistry()
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{name: "quote", want: "quote", wantOK: true},
+		{name: "QUOTE", want: "quote", wantOK: true},
+		{name: "q", want: "quote", wantOK: true},
+		{name: "Price", want: "quote", wantOK: true},
+		{name: "news", want: "news", wantOK: true},
+		{name: "/quote"},
+		{name: "quotes"},
+		{name: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, ok := r.Lookup(tt.name)
+			if ok != tt.wantOK {
+				t.Fatalf("Lookup(%q) ok = %v; want %v", tt.name, ok, tt.wantOK)
+			}
+			if ok && cmd.Name != tt.want {
+				t.Errorf("Lookup(%q) = %q; want %q", tt.name, cmd.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandRegistryRegisterReplaces(t *testing.T) {
+	r := newTestRegistry()
+	r.Register(Command{Name: "News", Description: "replaced", Handler: echoHandler})
+
+	cmd, ok := r.Lookup("news")
+	if !ok || cmd.Description != "replaced" {
+		t.Fatalf("Lookup(news) = %+v, %v; want the replacement", cmd, ok)
+	}
+	if got := len(r.Commands()); got != 4 {
+		t.Errorf("got %d commands; want 4", got)
+	}
+}
+
+func TestCommandRegistryDispatch(t *testing.T) {
+	r := newTestRegistry()
+	tests := []struct {
+		body string
+		want string // prefix of the single reply; empty means no reply
+	}{
+		{body: "/quote AAPL", want: "args: AAPL"},
+		{body: "  /quote   AAPL  ", want: "args: AAPL"},
+		{body: "/Q aapl", want: "args: aapl"},
+		{body: "/chart AAPL", want: "args: AAPL"},
+		{body: "/chart AAPL 1y", want: "args: AAPL 1y"},
+		{body: "/compare AAPL MSFT GOOG", want: "args: AAPL MSFT GOOG"},
+		{body: "/news", want: "args: "},
+		{body: "/quote", want: "Usage: `/quote SYMBOL` (e.g. `/quote AAPL`)"},
+		{body: "/quote AAPL MSFT", want: "Usage: `/quote SYMBOL`"},
+		{body: "/chart AAPL 1y extra", want: "Usage: `/chart SYMBOL [PERIOD]`"},
+		{body: "/compare", want: "Usage: `/compare SYMBOLS...`"},
+		{body: "/news today", want: "Usage: `/news`"},
+		{body: "/quot AAPL", want: "Unknown command `/quot`. Did you mean `/quote`?"},
+		{body: "/help quote", want: "**/quote SYMBOL**"},
+		{body: "/help /q", want: "**/quote SYMBOL**"},
+		{body: "/help", want: "🤖 **Bot Commands:**"},
+		{body: "hello"},
+		{body: "/"},
+		{body: ""},
+		{body: "quote /AAPL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			got := r.Dispatch(context.Background(), &hub.Message{Body: tt.body})
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Errorf("Dispatch(%q) = %v; want no reply", tt.body, got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.HasPrefix(got[0].Body, tt.want) {
+				t.Errorf("Dispatch(%q) = %v; want a reply starting %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandRegistrySuggest(t *testing.T) {
+	r := newTestRegistry().(*commandRegistry)
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "quot", want: []string{"quote"}},              // prefix
+		{name: "qoute", want: []string{"quote"}},             // distance 2
+		{name: "nwes", want: []string{"news"}},               // distance 2
+		{name: "nws", want: []string{"news"}},                // distance 1
+		{name: "chrat", want: []string{"chart"}},             // distance 2
+		{name: "NEWZ", want: []string{"news"}},               // case-insensitive
+		{name: "charting"},                                   // distance 3
+		{name: "xyzzy"},                                      // nothing close
+		{name: "c", want: []string{"chart", "compare", "q"}}, // prefixes, then a one-letter alias
+		{name: "p", want: []string{"price", "q"}},            // short names are within distance 1
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.suggest(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("suggest(%q) = %v; want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandRegistrySuggestCapsMatches(t *testing.T) {
+	r := NewCommandRegistry().(*commandRegistry)
+	for _, name := range []string{"aa", "ab", "ac", "ad", "ae"} {
+		r.Register(Command{Name: name, Handler: echoHandler})
+	}
+	if got := r.suggest("a"); !reflect.DeepEqual(got, []string{"aa", "ab", "ac"}) {
+		t.Errorf("suggest(a) = %v; want the first 3 matches", got)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "news", 4},
+		{"news", "news", 0},
+		{"nws", "news", 1},
+		{"qoute", "quote", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
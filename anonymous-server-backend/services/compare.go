@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+const (
+	// maxCompareSymbols caps how many tickers one /compare fetches.
+	maxCompareSymbols = 5
+	// comparePeriod is the chart history /compare rebases performance over.
+	comparePeriod = "1mo"
+)
+
+// SectorPerformance is one sector ETF from /api/sectors.
+type SectorPerformance struct {
+	Sector string  `json:"sector"`
+	ETF    string  `json:"etf"`
+	Price  float64 `json:"price"`
+	Change float64 `json:"change"`
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name:        "sectors",
+		Description: "View today's sector performance",
+		Handler:     HandleSectorsCommand,
+	})
+	RegisterCommand(Command{
+		Name: "compare",
+		Args: []CommandArg{
+			{Name: "SYMBOL", Required: true},
+			{Name: "SYMBOL", Required: true},
+			{Name: "SYMBOL", Variadic: true},
+		},
+		Description: "Compare tickers side by side",
+		Example:     "/compare AAPL MSFT GOOG",
+		Handler:     HandleCompareCommand,
+	})
+}
+
+// HandleSectorsCommand returns sector ETF performance, best first
+func HandleSectorsCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	var data struct {
+		Sectors []SectorPerformance `json:"sectors"`
+	}
+	if err := financeGetJSON(ctx, "/api/sectors", &data); err != nil {
+		return []BotResponse{{From: "bot", Body: friendlyError("sectors", err)}}
+	}
+	sectors := data.Sectors
+	sort.SliceStable(sectors, func(i, j int) bool { return sectors[i].Change > sectors[j].Change })
+
+	lines := []string{"🏭 **Sector Performance:**", ""}
+	table := TablePayload{Title: "Sector Performance", Columns: []string{"Sector", "ETF", "Price", "Change"}}
+	for _, s := range sectors {
+		emoji := "🔴"
+		if s.Change > 0 {
+			emoji = "🟢"
+		}
+		lines = append(lines, fmt.Sprintf("%s **%s** (%s) $%.2f (%+.2f%%)", emoji, s.Sector, s.ETF, s.Price, s.Change))
+		table.Rows = append(table.Rows, []string{s.Sector, s.ETF, fmt.Sprintf("%.2f", s.Price), fmt.Sprintf("%+.2f%%", s.Change)})
+	}
+	return botReply(strings.Join(lines, "\n"), hub.PayloadTable, table)
+}
+
+// HandleCompareCommand quotes several tickers side by side and charts their
+// performance rebased to 100
+func HandleCompareCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	parsed, bad, err := ParseSymbols(args)
+	if err != nil {
+		return invalidSymbolReply(bad)
+	}
+	var symbols []string
+	seen := map[string]bool{}
+	for _, sym := range parsed {
+		if !seen[sym] {
+			seen[sym] = true
+			symbols = append(symbols, sym)
+		}
+	}
+	if len(symbols) < 2 {
+		return []BotResponse{{From: "bot", Body: "Compare at least two different symbols, e.g. `/compare AAPL MSFT`."}}
+	}
+	if len(symbols) > maxCompareSymbols {
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("Compare up to %d symbols at a time.", maxCompareSymbols)}}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		quotes []*StockResponse
+		errs   []error
+		charts = make([]*ChartPayload, len(symbols))
+	)
+	wg.Add(1 + len(symbols))
+	go func() {
+		defer wg.Done()
+		quotes, errs = fetchQuotes(ctx, symbols)
+	}()
+	for i, sym := range symbols {
+		go func() {
+			defer wg.Done()
+			var chart ChartPayload
+			if err := financeGetJSON(ctx, chartPath(sym, comparePeriod), &chart); err == nil {
+				charts[i] = &chart
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := []string{"⚖️ **Comparison:**", ""}
+	table := TablePayload{
+		Title:   "Comparison",
+		Columns: []string{"Symbol", "Price", "Change", "EMA20", comparePeriod + " Return"},
+	}
+	compare := ComparePayload{Period: comparePeriod}
+	var failed []string
+	for i, sym := range symbols {
+		q := quotes[i]
+		if q == nil {
+			failed = append(failed, sym)
+			continue
+		}
+		periodReturn := "n/a"
+		if series := rebase(charts[i]); series != nil {
+			compare.Series = append(compare.Series, CompareSeries{Symbol: sym, Points: series})
+			periodReturn = fmt.Sprintf("%+.2f%%", series[len(series)-1].Close-100)
+		}
+		lines = append(lines, fmt.Sprintf("**%s** $%.2f (%+.2f%%)  EMA20 $%.2f  %s: %s",
+			sym, q.Price, q.Change, q.EMA20, comparePeriod, periodReturn))
+		table.Rows = append(table.Rows, []string{
+			sym, fmt.Sprintf("%.2f", q.Price), fmt.Sprintf("%+.2f%%", q.Change), fmt.Sprintf("%.2f", q.EMA20), periodReturn,
+		})
+	}
+	if len(table.Rows) == 0 {
+		return []BotResponse{{From: "bot", Body: friendlyError(strings.Join(symbols, ", "), errs[0])}}
+	}
+	if len(failed) > 0 {
+		lines = append(lines, "", "⚠️ Couldn't fetch "+strings.Join(failed, ", "))
+	}
+
+	replies := botReply(strings.Join(lines, "\n"), hub.PayloadTable, table)
+	if len(compare.Series) > 1 {
+		replies = append(replies, botReply(
+			fmt.Sprintf("📈 %s performance over %s, rebased to 100", strings.Join(symbols, " vs "), comparePeriod),
+			hub.PayloadCompare, compare)...)
+	}
+	return replies
+}
+
+// rebase scales a chart so its first close is 100, or returns nil if it
+// cannot be rebased.
+func rebase(c *ChartPayload) []ChartPoint {
+	if c == nil || len(c.Points) == 0 || c.Points[0].Close == 0 {
+		return nil
+	}
+	base := c.Points[0].Close
+	out := make([]ChartPoint, len(c.Points))
+	for i, p := range c.Points {
+		out[i] = ChartPoint{Date: p.Date, Close: p.Close / base * 100}
+	}
+	return out
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/zelshahawy/Anonymous_backend/config"
 	"go.mongodb.org/mongo-driver/bson"
@@ -10,24 +11,119 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// LoadRecentMessages loads the most recent messages between two users.
+// conversationFilter matches every message in the conversation between userID
+// and otherID, where otherID is either a user or a room.
+func conversationFilter(userID, otherID string) bson.M {
+	if IsRoomID(otherID) {
+		return bson.M{"to": otherID}
+	}
+	return bson.M{
+		"$or": []bson.M{
+			{"from": userID, "to": otherID},
+			{"from": otherID, "to": userID},
+		},
+	}
+}
+
+// LoadRecentMessages loads the most recent messages between two users, or in a
+// room when otherUserID is a room ID.
 func LoadRecentMessages(ctx context.Context, userID, otherUserID string, limit int) ([]MessageDoc, error) {
+	messages, _, err := LoadMessagePage(ctx, userID, otherUserID, "", "", limit)
+	return messages, err
+}
+
+// LoadMessagePage loads one page of a conversation in chronological order using
+// message ULIDs as cursors. With only after set it returns the oldest messages
+// newer than after; otherwise it returns the newest messages older than before
+// (and newer than after, if set). hasMore reports whether further messages
+// exist beyond the page in the direction being paged.
+func LoadMessagePage(ctx context.Context, userID, otherUserID, before, after string, limit int) ([]MessageDoc, bool, error) {
 	var messages []MessageDoc
 
-	cursor, err := config.DBClients.MessagesCollection.Find(ctx, bson.M{
+	idRange := bson.M{}
+	if before != "" {
+		idRange["$lt"] = before
+	}
+	if after != "" {
+		idRange["$gt"] = after
+	}
+	filter := conversationFilter(userID, otherUserID)
+	if len(idRange) > 0 {
+		filter = bson.M{"$and": []bson.M{filter, {"msgId": idRange}}}
+	}
+
+	forward := after != "" && before == ""
+	order := -1
+	if forward {
+		order = 1
+	}
+
+	// Fetch one extra message to learn whether another page exists.
+	cursor, err := config.DBClients.MessagesCollection.Find(ctx, filter, &options.FindOptions{
+		Sort:  bson.D{{Key: "msgId", Value: order}},
+		Limit: &[]int64{int64(limit) + 1}[0],
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var msg MessageDoc
+		if err := cursor.Decode(&msg); err != nil {
+			log.Printf("failed to decode message: %v", err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	if !forward {
+		// Reverse to get chronological order
+		for i := len(messages)/2 - 1; i >= 0; i-- {
+			opp := len(messages) - 1 - i
+			messages[i], messages[opp] = messages[opp], messages[i]
+		}
+	}
+
+	return messages, hasMore, nil
+}
+
+// LoadMessagesSince loads, in ULID order, every message sent by or addressed to
+// userID (including messages in the user's rooms) that is newer than since.
+// hasMore reports whether more than limit messages were available.
+func LoadMessagesSince(ctx context.Context, userID, since string, limit int) ([]MessageDoc, bool, error) {
+	rooms, err := LoadUserRooms(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	roomIDs := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		roomIDs = append(roomIDs, room.RoomID)
+	}
+
+	filter := bson.M{
+		"msgId": bson.M{"$gt": since},
 		"$or": []bson.M{
-			{"from": userID, "to": otherUserID},
-			{"from": otherUserID, "to": userID},
+			{"from": userID},
+			{"to": userID},
+			{"to": bson.M{"$in": roomIDs}},
 		},
-	}, &options.FindOptions{
-		Sort:  bson.M{"_id": -1},
-		Limit: &[]int64{int64(limit)}[0],
+	}
+	cursor, err := config.DBClients.MessagesCollection.Find(ctx, filter, &options.FindOptions{
+		Sort:  bson.D{{Key: "msgId", Value: 1}},
+		Limit: &[]int64{int64(limit) + 1}[0],
 	})
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	defer cursor.Close(ctx)
 
+	var messages []MessageDoc
 	for cursor.Next(ctx) {
 		var msg MessageDoc
 		if err := cursor.Decode(&msg); err != nil {
@@ -37,25 +133,33 @@ func LoadRecentMessages(ctx context.Context, userID, otherUserID string, limit i
 		messages = append(messages, msg)
 	}
 
-	// Reverse to get chronological order
-	for i := len(messages)/2 - 1; i >= 0; i-- {
-		opp := len(messages) - 1 - i
-		messages[i], messages[opp] = messages[opp], messages[i]
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
 	}
+	return messages, hasMore, nil
+}
 
-	return messages, nil
+// unreadMessagesFilter matches direct messages and bot notifications sent to
+// userID that have not been announced to them yet.
+func unreadMessagesFilter(userID string) bson.M {
+	return bson.M{
+		"to":       userID,
+		"notified": false,
+		"$or": bson.A{
+			bson.M{"type": "chat"},
+			bson.M{"type": "bot", "from": BotSender},
+		},
+	}
 }
 
-// LoadUnreadChatCounts returns unread chat-message counts grouped by sender.
+// LoadUnreadChatCounts returns unread chat-message counts grouped by sender for
+// direct messages and by room ID for rooms the user belongs to.
 func LoadUnreadChatCounts(ctx context.Context, userID string) (map[string]int, error) {
 	counts := make(map[string]int)
 
 	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{
-			"to":       userID,
-			"type":     "chat",
-			"notified": false,
-		}}},
+		{{Key: "$match", Value: unreadMessagesFilter(userID)}},
 		{{Key: "$group", Value: bson.M{
 			"_id":   "$from",
 			"count": bson.M{"$sum": 1},
@@ -84,18 +188,50 @@ func LoadUnreadChatCounts(ctx context.Context, userID string) (map[string]int, e
 		counts[row.From] = row.Count
 	}
 
+	rooms, err := LoadUserRooms(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range rooms {
+		var since time.Time
+		for _, m := range room.Members {
+			if m.UserID == userID {
+				since = m.NotifiedAt
+			}
+		}
+		n, err := config.DBClients.MessagesCollection.CountDocuments(ctx, bson.M{
+			"to":        room.RoomID,
+			"type":      "chat",
+			"from":      bson.M{"$ne": userID},
+			"timestamp": bson.M{"$gt": since},
+		})
+		if err != nil {
+			log.Printf("failed to count unread messages in room %s: %v", room.RoomID, err)
+			continue
+		}
+		if n > 0 {
+			counts[room.RoomID] = int(n)
+		}
+	}
+
 	return counts, nil
 }
 
-// MarkUnreadChatMessagesNotified marks unread chat messages to user as notified.
+// MarkUnreadChatMessagesNotified marks unread chat messages to user as notified,
+// including messages in every room the user belongs to.
 func MarkUnreadChatMessagesNotified(ctx context.Context, userID string) error {
-	_, err := config.DBClients.MessagesCollection.UpdateMany(
+	_, err := roomsCollection().UpdateMany(
 		ctx,
-		bson.M{
-			"to":       userID,
-			"type":     "chat",
-			"notified": false,
-		},
+		bson.M{"members.userId": userID},
+		bson.M{"$set": bson.M{"members.$.notifiedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = config.DBClients.MessagesCollection.UpdateMany(
+		ctx,
+		unreadMessagesFilter(userID),
 		bson.M{
 			"$set": bson.M{"notified": true},
 		},
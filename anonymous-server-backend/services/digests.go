@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // the runtime image ships without zoneinfo
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+const (
+	// DigestDaily and DigestWeekdays are the supported digest schedules.
+	DigestDaily    = "daily"
+	DigestWeekdays = "weekdays"
+
+	// digestPollInterval is how often the scheduler looks for due digests.
+	digestPollInterval = 30 * time.Second
+	// digestGrace is how late a digest may still be sent, e.g. after a
+	// restart. Older runs are skipped rather than delivered hours late.
+	digestGrace = time.Hour
+	// defaultDigestZone is used when /digest is given no timezone.
+	defaultDigestZone = "UTC"
+	// digestNewsLimit is how many headlines a digest includes.
+	digestNewsLimit = 5
+)
+
+// ErrInvalidDigestSchedule is returned for an unknown schedule, time or timezone.
+var ErrInvalidDigestSchedule = errors.New("invalid digest schedule")
+
+// DigestDoc is a user's market digest subscription. NextRunAt is persisted so
+// the schedule survives restarts and is shared by every server instance.
+type DigestDoc struct {
+	UserID    string     `bson:"userId"`
+	Schedule  string     `bson:"schedule"`
+	At        string     `bson:"at"` // "HH:MM" in Timezone
+	Timezone  string     `bson:"timezone"`
+	NextRunAt time.Time  `bson:"nextRunAt"`
+	LastRunAt *time.Time `bson:"lastRunAt,omitempty"`
+	CreatedAt time.Time  `bson:"createdAt"`
+}
+
+// nextRun returns the first scheduled time strictly after t.
+func (d *DigestDoc) nextRun(t time.Time) (time.Time, error) {
+	return nextDigestRun(d.Schedule, d.At, d.Timezone, t)
+}
+
+// nextDigestRun returns the first time after t that matches schedule at the
+// "HH:MM" clock time in the named timezone.
+func nextDigestRun(schedule, at, zone string, t time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.Time{}, ErrInvalidDigestSchedule
+	}
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, ErrInvalidDigestSchedule
+	}
+	if schedule != DigestDaily && schedule != DigestWeekdays {
+		return time.Time{}, ErrInvalidDigestSchedule
+	}
+
+	local := t.In(loc)
+	for day := 0; day <= 7; day++ {
+		y, m, dd := local.AddDate(0, 0, day).Date()
+		run := time.Date(y, m, dd, clock.Hour(), clock.Minute(), 0, 0, loc)
+		if !run.After(t) {
+			continue
+		}
+		if schedule == DigestWeekdays && (run.Weekday() == time.Saturday || run.Weekday() == time.Sunday) {
+			continue
+		}
+		return run, nil
+	}
+	return time.Time{}, ErrInvalidDigestSchedule
+}
+
+// digestsCollection returns the MongoDB collection handle for digest subscriptions.
+func digestsCollection() *mongo.Collection {
+	dbName := config.Configuration.Database
+	return config.DBClients.MongoClient.Database(dbName).Collection("digests")
+}
+
+// SubscribeDigest creates or replaces userID's digest subscription.
+func SubscribeDigest(ctx context.Context, userID, schedule, at, zone string) (*DigestDoc, error) {
+	next, err := nextDigestRun(schedule, at, zone, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	doc := DigestDoc{
+		UserID:    userID,
+		Schedule:  schedule,
+		At:        at,
+		Timezone:  zone,
+		NextRunAt: next,
+		CreatedAt: time.Now(),
+	}
+	_, err = digestsCollection().ReplaceOne(ctx, bson.M{"userId": userID}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// UnsubscribeDigest removes userID's digest subscription. It reports whether
+// there was one.
+func UnsubscribeDigest(ctx context.Context, userID string) (bool, error) {
+	res, err := digestsCollection().DeleteOne(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// FindDigest returns userID's digest subscription, or nil if they have none.
+func FindDigest(ctx context.Context, userID string) (*DigestDoc, error) {
+	var doc DigestDoc
+	err := digestsCollection().FindOne(ctx, bson.M{"userId": userID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// RunDigests sends due digests every digestPollInterval until ctx is done.
+func RunDigests(ctx context.Context) {
+	ticker := time.NewTicker(digestPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sendDueDigests(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("digest run failed: %v", err)
+			}
+		}
+	}
+}
+
+func sendDueDigests(ctx context.Context) error {
+	now := time.Now()
+	cursor, err := digestsCollection().Find(ctx, bson.M{"nextRunAt": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	var due []DigestDoc
+	if err := cursor.All(ctx, &due); err != nil {
+		return err
+	}
+
+	for i := range due {
+		d := &due[i]
+		next, err := d.nextRun(now)
+		if err != nil {
+			log.Printf("digest for %s has a bad schedule, removing it: %v", d.UserID, err)
+			if _, err := UnsubscribeDigest(ctx, d.UserID); err != nil {
+				log.Printf("failed to remove digest for %s: %v", d.UserID, err)
+			}
+			continue
+		}
+		// Claim the run by moving nextRunAt; only one instance wins.
+		res, err := digestsCollection().UpdateOne(ctx,
+			bson.M{"userId": d.UserID, "nextRunAt": d.NextRunAt},
+			bson.M{"$set": bson.M{"nextRunAt": next, "lastRunAt": now}},
+		)
+		if err != nil {
+			log.Printf("failed to schedule next digest for %s: %v", d.UserID, err)
+			continue
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+		if now.Sub(d.NextRunAt) > digestGrace {
+			log.Printf("skipping digest for %s that was due at %s", d.UserID, d.NextRunAt.Format(time.RFC3339))
+			continue
+		}
+		NotifyUser(ctx, d.UserID, composeDigest(ctx, d.UserID), nil)
+	}
+	return nil
+}
+
+// composeDigest builds the digest body from indices, top movers, the user's
+// watchlist and market news, fetched concurrently. Sections that fail to
+// load are left out.
+func composeDigest(ctx context.Context, userID string) string {
+	var (
+		wg        sync.WaitGroup
+		indices   map[string]map[string]any
+		movers    []StockResponse
+		watchRows []map[string]any
+		news      []map[string]any
+		errIdx    error
+		errMovers error
+		errNews   error
+	)
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		errIdx = financeGetJSON(ctx, "/api/indices", &indices)
+	}()
+	go func() {
+		defer wg.Done()
+		movers, errMovers = fetchTopMovers(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		symbols, err := LoadWatchlist(ctx, userID)
+		if err != nil {
+			log.Printf("digest: failed to load watchlist for %s: %v", userID, err)
+			return
+		}
+		quotes, _ := fetchQuotes(ctx, symbols)
+		for _, q := range quotes {
+			if q != nil {
+				watchRows = append(watchRows, map[string]any{
+					"symbol": q.Symbol, "price": q.Price, "change": q.Change, "ema20": q.EMA20,
+				})
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		errNews = financeGetJSON(ctx, newsPath("", digestNewsLimit), &news)
+	}()
+	wg.Wait()
+
+	sections := []string{"☀️ **Your Market Digest**"}
+	if errIdx == nil && len(indices) > 0 {
+		names := make([]string, 0, len(indices))
+		for name := range indices {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		vals := make([]map[string]any, 0, len(indices))
+		for _, name := range names {
+			vals = append(vals, indices[name])
+		}
+		sections = append(sections, formatStockLines("📊 **Market Indices:**", vals, len(vals)))
+	}
+	if errMovers == nil && len(movers) > 0 {
+		sort.Slice(movers, func(i, j int) bool { return movers[i].Change > movers[j].Change })
+		rows := make([]map[string]any, 0, len(movers))
+		for _, m := range movers {
+			rows = append(rows, map[string]any{"symbol": m.Symbol, "price": m.Price, "change": m.Change})
+		}
+		sections = append(sections, formatStockLines("🚀 **Top Movers:**", rows, 5))
+	}
+	if len(watchRows) > 0 {
+		sections = append(sections, formatStockLines("👀 **Your Watchlist:**", watchRows, len(watchRows)))
+	}
+	if errNews == nil && len(news) > 0 {
+		sections = append(sections, formatNewsLines("", news, 3))
+	}
+	if len(sections) == 1 {
+		sections = append(sections, "Market data is unavailable right now, sorry! We'll try again next time.")
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "digest",
+		Args: []CommandArg{
+			{Name: "daily|weekdays|off"},
+			{Name: "HH:MM"},
+			{Name: "TIMEZONE"},
+		},
+		Description: "Get a scheduled market summary; `/digest off` stops it",
+		Example:     "/digest daily 09:00 America/New_York",
+		Handler:     HandleDigestCommand,
+	})
+}
+
+// HandleDigestCommand subscribes to, cancels or shows the sender's digest
+func HandleDigestCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	if len(args) == 0 {
+		d, err := FindDigest(ctx, in.From)
+		if err != nil {
+			log.Printf("failed to load digest for %s: %v", in.From, err)
+			return []BotResponse{{From: "bot", Body: "Couldn't load your digest. Try again in a moment!"}}
+		}
+		if d == nil {
+			return []BotResponse{{From: "bot", Body: "You have no digest. Try `/digest daily 09:00 America/New_York`."}}
+		}
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("☀️ Your digest runs %s at %s %s. Next one: %s.",
+			d.Schedule, d.At, d.Timezone, digestTime(d))}}
+	}
+
+	if strings.EqualFold(args[0], "off") {
+		removed, err := UnsubscribeDigest(ctx, in.From)
+		if err != nil {
+			log.Printf("failed to remove digest for %s: %v", in.From, err)
+			return []BotResponse{{From: "bot", Body: "Couldn't turn off your digest. Try again in a moment!"}}
+		}
+		if !removed {
+			return []BotResponse{{From: "bot", Body: "You don't have a digest."}}
+		}
+		return []BotResponse{{From: "bot", Body: "Digest turned off."}}
+	}
+
+	cmd, _ := Commands.Lookup("digest")
+	if len(args) < 2 {
+		return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+	}
+	zone := defaultDigestZone
+	if len(args) > 2 {
+		zone = args[2]
+	}
+	d, err := SubscribeDigest(ctx, in.From, strings.ToLower(args[0]), args[1], zone)
+	switch {
+	case errors.Is(err, ErrInvalidDigestSchedule):
+		return []BotResponse{{From: "bot", Body: usageReply(cmd) + " Times are 24-hour, timezones look like `Europe/London`."}}
+	case err != nil:
+		log.Printf("failed to save digest for %s: %v", in.From, err)
+		return []BotResponse{{From: "bot", Body: "Couldn't save your digest. Try again in a moment!"}}
+	}
+	return []BotResponse{{From: "bot", Body: fmt.Sprintf("☀️ Digest set: %s at %s %s. First one arrives %s.",
+		d.Schedule, d.At, d.Timezone, digestTime(d))}}
+}
+
+// digestTime renders a digest's next run in its own timezone.
+func digestTime(d *DigestDoc) string {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return d.NextRunAt.In(loc).Format("Mon Jan 2 15:04 MST")
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultFinanceTTL is how long a response stays fresh when no
+	// endpoint-specific freshness applies.
+	defaultFinanceTTL = 30 * time.Second
+	// financeMaxStale is how long past freshness a response may still be
+	// served while it is refreshed, or while the service is down.
+	financeMaxStale = 30 * time.Minute
+	// financeFetchTimeout bounds a shared upstream fetch, which outlives the
+	// caller that started it. It leaves room for every client retry.
+	financeFetchTimeout = financeRetryBudget + time.Second
+	// financeCacheSize is the most responses kept. When it is reached, expired
+	// responses are swept and then the oldest is evicted.
+	financeCacheSize = 1024
+)
+
+// financeTTLs sets freshness per finance API endpoint, matched by path prefix.
+var financeTTLs = []struct {
+	prefix string
+	ttl    time.Duration
+}{
+	{"/api/stocks/", 30 * time.Second},
+	{"/api/crypto", 30 * time.Second},
+	{"/api/indices", 30 * time.Second},
+	{"/api/top-movers", time.Minute},
+	{"/api/trending", 2 * time.Minute},
+	{"/api/news", 5 * time.Minute},
+	{"/api/chart/", 10 * time.Minute},
+}
+
+// financeTTL returns the freshness for a finance API path.
+func financeTTL(path string) time.Duration {
+	for _, e := range financeTTLs {
+		if strings.HasPrefix(path, e.prefix) {
+			return e.ttl
+		}
+	}
+	return defaultFinanceTTL
+}
+
+type cacheEntry struct {
+	body      []byte
+	fetchedAt time.Time
+	ttl       time.Duration // freshness the entry was fetched with
+}
+
+// expired reports whether the entry is too stale to serve at all.
+func (e cacheEntry) expired() bool {
+	return time.Since(e.fetchedAt) > e.ttl+financeMaxStale
+}
+
+// inflight is a fetch that concurrent identical lookups wait on. If it
+// failed, body may hold the last cached copy and stale is set.
+type inflight struct {
+	done  chan struct{}
+	body  []byte
+	err   error
+	stale bool
+}
+
+// financeCache is a TTL cache over finance API responses. Identical lookups
+// share one upstream request, and stale responses are served while they are
+// refreshed in the background or when the service is failing.
+type financeCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	calls   map[string]*inflight
+	fetch   func(ctx context.Context, path string) ([]byte, error)
+}
+
+func newFinanceCache(fetch func(ctx context.Context, path string) ([]byte, error)) *financeCache {
+	return &financeCache{
+		entries: make(map[string]cacheEntry),
+		calls:   make(map[string]*inflight),
+		fetch:   fetch,
+	}
+}
+
+// Get returns the response body for path, fetching it only when no usable
+// cached copy exists. ttl is how long a fetched body counts as fresh.
+func (c *financeCache) Get(ctx context.Context, path string, ttl time.Duration) ([]byte, error) {
+	return c.get(ctx, path, ttl, true)
+}
+
+// GetFresh is like Get but never returns a body older than ttl, for callers
+// such as trade fills that must not act on outdated prices.
+func (c *financeCache) GetFresh(ctx context.Context, path string, ttl time.Duration) ([]byte, error) {
+	return c.get(ctx, path, ttl, false)
+}
+
+func (c *financeCache) get(ctx context.Context, path string, ttl time.Duration, allowStale bool) ([]byte, error) {
+	c.mu.Lock()
+	entry, cached := c.entries[path]
+	age := time.Since(entry.fetchedAt)
+	if cached && age > ttl+financeMaxStale {
+		delete(c.entries, path)
+		cached = false
+	}
+	if cached && age <= ttl {
+		c.mu.Unlock()
+		return entry.body, nil
+	}
+	call := c.startLocked(path, ttl)
+	c.mu.Unlock()
+
+	// Stale but usable: answer now and let the refresh finish on its own.
+	if cached && allowStale {
+		return entry.body, nil
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.err != nil && !(call.stale && allowStale) {
+		return nil, call.err
+	}
+	return call.body, nil
+}
+
+// startLocked joins the in-flight fetch for path or starts a new one whose
+// result is cached with the given ttl. c.mu must be held.
+func (c *financeCache) startLocked(path string, ttl time.Duration) *inflight {
+	if call, ok := c.calls[path]; ok {
+		return call
+	}
+	call := &inflight{done: make(chan struct{})}
+	c.calls[path] = call
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), financeFetchTimeout)
+		defer cancel()
+		body, err := c.fetch(ctx, path)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.calls, path)
+		if err == nil {
+			c.storeLocked(path, cacheEntry{body: body, fetchedAt: time.Now(), ttl: ttl})
+		} else if entry, ok := c.entries[path]; ok {
+			log.Printf("finance API failed, cached copy from %s is available: %v path=%s",
+				entry.fetchedAt.Format(time.RFC3339), err, path)
+			body, call.stale = entry.body, true
+		}
+		call.body, call.err = body, err
+		close(call.done)
+	}()
+	return call
+}
+
+// storeLocked caches entry for path. When the cache is full and path is new,
+// it sweeps expired entries and, if none were, evicts the oldest one. c.mu
+// must be held.
+func (c *financeCache) storeLocked(path string, entry cacheEntry) {
+	if _, ok := c.entries[path]; !ok && len(c.entries) >= financeCacheSize {
+		for k, e := range c.entries {
+			if e.expired() {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= financeCacheSize {
+			c.evictOldestLocked()
+		}
+	}
+	c.entries[path] = entry
+}
+
+// evictOldestLocked removes the least recently fetched entry. c.mu must be held.
+func (c *financeCache) evictOldestLocked() {
+	var (
+		oldest string
+		at     time.Time
+	)
+	for k, e := range c.entries {
+		if oldest == "" || e.fetchedAt.Before(at) {
+			oldest, at = k, e.fetchedAt
+		}
+	}
+	delete(c.entries, oldest)
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeFetch is a controllable finance API for cache tests.
+type fakeFetch struct {
+	calls   atomic.Int32
+	body    string
+	err     error
+	release chan struct{} // if set, fetches block until it is closed
+}
+
+func (f *fakeFetch) fetch(ctx context.Context, path string) ([]byte, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte(f.body), nil
+}
+
+func TestFinanceCacheCoalescesLookups(t *testing.T) {
+	f := &fakeFetch{body: "fresh", release: make(chan struct{})}
+	c := newFinanceCache(f.fetch)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := c.Get(context.Background(), "/api/stocks/AAPL", time.Minute)
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+			bodies[i] = string(b)
+		}()
+	}
+	for f.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // let the other lookups join the fetch
+	close(f.release)
+	wg.Wait()
+
+	if got := f.calls.Load(); got != 1 {
+		t.Errorf("fetched %d times; want 1", got)
+	}
+	for i, b := range bodies {
+		if b != "fresh" {
+			t.Errorf("lookup %d got %q; want %q", i, b, "fresh")
+		}
+	}
+}
+
+func TestFinanceCacheLookups(t *testing.T) {
+	upstreamErr := &FinanceError{Kind: ErrFinanceUpstream}
+	tests := []struct {
+		name      string
+		age       time.Duration // age of the cached copy; zero means none
+		fresh     bool          // use GetFresh
+		fetchErr  error
+		wantBody  string
+		wantErr   error
+		wantFetch bool
+	}{
+		{name: "miss fetches", wantBody: "new", wantFetch: true},
+		{name: "fresh hit", age: time.Second, wantBody: "old"},
+		{name: "stale is served while refreshing", age: 2 * time.Minute, wantBody: "old", wantFetch: true},
+		{name: "stale fallback on failure", age: 2 * time.Minute, fetchErr: upstreamErr, wantBody: "old", wantFetch: true},
+		{name: "too stale is dropped", age: time.Minute + financeMaxStale + time.Second, wantBody: "new", wantFetch: true},
+		{name: "GetFresh waits for a refresh", age: 2 * time.Minute, fresh: true, wantBody: "new", wantFetch: true},
+		{name: "GetFresh never falls back", age: 2 * time.Minute, fresh: true, fetchErr: upstreamErr, wantErr: ErrFinanceUpstream, wantFetch: true},
+		{name: "miss with failure", fetchErr: upstreamErr, wantErr: ErrFinanceUpstream, wantFetch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const path = "/api/stocks/AAPL"
+			f := &fakeFetch{body: "new", err: tt.fetchErr}
+			c := newFinanceCache(f.fetch)
+			if tt.age > 0 {
+				c.entries[path] = cacheEntry{body: []byte("old"), fetchedAt: time.Now().Add(-tt.age)}
+			}
+
+			get := c.Get
+			if tt.fresh {
+				get = c.GetFresh
+			}
+			body, err := get(context.Background(), path, time.Minute)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v; want %v", err, tt.wantErr)
+				}
+			} else if err != nil || string(body) != tt.wantBody {
+				t.Fatalf("got %q, %v; want %q", body, err, tt.wantBody)
+			}
+
+			// Wait for a background refresh to land before counting.
+			c.mu.Lock()
+			call := c.calls[path]
+			c.mu.Unlock()
+			if call != nil {
+				<-call.done
+			}
+			if got := f.calls.Load() > 0; got != tt.wantFetch {
+				t.Errorf("fetched = %v; want %v", got, tt.wantFetch)
+			}
+		})
+	}
+}
+
+func TestFinanceCacheCallerCancel(t *testing.T) {
+	f := &fakeFetch{body: "new", release: make(chan struct{})}
+	c := newFinanceCache(f.fetch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, "/api/news", time.Minute); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get() error = %v; want %v", err, context.Canceled)
+	}
+
+	// The shared fetch outlives the caller and still fills the cache.
+	close(f.release)
+	body, err := c.Get(context.Background(), "/api/news", time.Minute)
+	if err != nil || string(body) != "new" {
+		t.Fatalf("Get() = %q, %v; want %q", body, err, "new")
+	}
+	if got := f.calls.Load(); got != 1 {
+		t.Errorf("fetched %d times; want 1", got)
+	}
+}
+
+func TestFinanceTTL(t *testing.T) {
+	tests := []struct {
+		path string
+		want time.Duration
+	}{
+		{"/api/stocks/AAPL", 30 * time.Second},
+		{"/api/chart/AAPL?period=1mo", 10 * time.Minute},
+		{"/api/news?limit=5", 5 * time.Minute},
+		{"/api/sectors", defaultFinanceTTL},
+	}
+	for _, tt := range tests {
+		if got := financeTTL(tt.path); got != tt.want {
+			t.Errorf("financeTTL(%q) = %s; want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFinanceCacheStoreWhenFull(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      map[string]cacheEntry // entries besides the fresh filler
+		store    string
+		wantGone []string
+		wantKept []string
+	}{
+		{
+			name:     "existing key is refreshed",
+			old:      map[string]cacheEntry{"/old": {fetchedAt: time.Now().Add(-time.Hour), ttl: time.Hour}},
+			store:    "/old",
+			wantKept: []string{"/old"},
+		},
+		{
+			name:     "oldest is evicted",
+			old:      map[string]cacheEntry{"/old": {fetchedAt: time.Now().Add(-time.Hour), ttl: time.Hour}},
+			store:    "/new",
+			wantGone: []string{"/old"},
+			wantKept: []string{"/new"},
+		},
+		{
+			name: "sweep uses each entry's ttl",
+			old: map[string]cacheEntry{
+				"/api/chart/AAPL":  {fetchedAt: time.Now().Add(-35 * time.Minute), ttl: 10 * time.Minute},
+				"/api/stocks/AAPL": {fetchedAt: time.Now().Add(-31 * time.Minute), ttl: 30 * time.Second},
+			},
+			store:    "/new",
+			wantGone: []string{"/api/stocks/AAPL"},
+			wantKept: []string{"/api/chart/AAPL", "/new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFinanceCache((&fakeFetch{}).fetch)
+			for k, e := range tt.old {
+				c.entries[k] = e
+			}
+			for i := 0; len(c.entries) < financeCacheSize; i++ {
+				c.entries[fmt.Sprintf("/fill/%d", i)] = cacheEntry{fetchedAt: time.Now(), ttl: time.Minute}
+			}
+
+			c.storeLocked(tt.store, cacheEntry{body: []byte("new"), fetchedAt: time.Now(), ttl: time.Minute})
+
+			if len(c.entries) != financeCacheSize {
+				t.Errorf("cache holds %d entries; want %d", len(c.entries), financeCacheSize)
+			}
+			if got := string(c.entries[tt.store].body); got != "new" {
+				t.Errorf("%s = %q; want %q", tt.store, got, "new")
+			}
+			for _, k := range tt.wantGone {
+				if _, ok := c.entries[k]; ok {
+					t.Errorf("%s still cached", k)
+				}
+			}
+			for _, k := range tt.wantKept {
+				if _, ok := c.entries[k]; !ok {
+					t.Errorf("%s was dropped", k)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// financeAttemptTimeout bounds a single request to the finance API.
+	financeAttemptTimeout = 4 * time.Second
+	// financeMaxAttempts is how many times an idempotent GET is tried.
+	financeMaxAttempts = 3
+	// financeBackoff and financeMaxBackoff bound the jittered retry delay.
+	financeBackoff    = 200 * time.Millisecond
+	financeMaxBackoff = time.Second
+	// financeRetryBudget is the longest Get can take with every attempt
+	// timing out; callers' deadlines should allow for it.
+	financeRetryBudget = financeMaxAttempts*financeAttemptTimeout + (financeMaxAttempts-1)*financeMaxBackoff
+
+	// breakerThreshold is how many consecutive failed requests open the breaker.
+	breakerThreshold = 5
+	// breakerCooldown is how long an open breaker rejects requests before
+	// letting a single probe through.
+	breakerCooldown = 30 * time.Second
+)
+
+var (
+	// ErrFinanceUnavailable is returned when the finance API cannot be reached.
+	ErrFinanceUnavailable = errors.New("finance service unreachable")
+	// ErrFinanceTimeout is returned when the finance API does not answer in time.
+	ErrFinanceTimeout = errors.New("finance service timed out")
+	// ErrFinanceNotFound is returned when the finance API has no data for a lookup.
+	ErrFinanceNotFound = errors.New("finance data not found")
+	// ErrFinanceRateLimited is returned when the finance API rejects us with 429.
+	ErrFinanceRateLimited = errors.New("finance service rate limited")
+	// ErrFinanceUpstream is returned for 5xx and other unexpected statuses.
+	ErrFinanceUpstream = errors.New("finance service error")
+	// ErrFinanceBadResponse is returned when a response cannot be decoded.
+	ErrFinanceBadResponse = errors.New("unexpected finance service response")
+	// ErrFinanceCircuitOpen is returned without calling the finance API while
+	// the circuit breaker is open.
+	ErrFinanceCircuitOpen = errors.New("finance service circuit open")
+)
+
+// FinanceError describes a failed finance API call. It matches one of the
+// ErrFinance* sentinels with errors.Is.
+type FinanceError struct {
+	URL    string
+	Status int // HTTP status, zero if no response was received
+	Kind   error
+	Err    error
+
+	retryAfter time.Duration
+}
+
+func (e *FinanceError) Error() string {
+	msg := fmt.Sprintf("%v: GET %s", e.Kind, e.URL)
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" returned %d", e.Status)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *FinanceError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// retryable reports whether another attempt could succeed.
+func (e *FinanceError) retryable() bool {
+	switch e.Kind {
+	case ErrFinanceUnavailable, ErrFinanceTimeout, ErrFinanceRateLimited, ErrFinanceUpstream:
+		return true
+	}
+	return false
+}
+
+// tripsBreaker reports whether the failure means the service itself is unhealthy.
+func (e *FinanceError) tripsBreaker() bool {
+	switch e.Kind {
+	case ErrFinanceUnavailable, ErrFinanceTimeout, ErrFinanceUpstream:
+		return true
+	}
+	return false
+}
+
+// Circuit breaker states reported by FinanceHealth.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// FinanceHealth is a snapshot of the finance client's circuit breaker.
+type FinanceHealth struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// circuitBreaker stops calls to a failing service for breakerCooldown after
+// breakerThreshold consecutive failures, then admits one probe at a time.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError error
+}
+
+// allow reports whether a request may be sent now.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < breakerCooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures >= breakerThreshold {
+		log.Printf("finance API recovered, closing circuit breaker")
+	}
+	b.failures, b.probing, b.lastError = 0, false, nil
+}
+
+func (b *circuitBreaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastError = err
+	if b.probing || b.failures == breakerThreshold {
+		log.Printf("finance API failing, opening circuit breaker for %s: %v", breakerCooldown, err)
+		b.openedAt = time.Now()
+	}
+	b.probing = false
+}
+
+// release gives up a probe slot without recording an outcome, e.g. when the
+// caller's context was cancelled.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) health() FinanceHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := FinanceHealth{State: BreakerClosed, ConsecutiveFailures: b.failures}
+	if b.lastError != nil {
+		h.LastError = b.lastError.Error()
+	}
+	if b.failures >= breakerThreshold {
+		openedAt := b.openedAt
+		h.OpenedAt = &openedAt
+		h.State = BreakerOpen
+		if b.probing || time.Since(b.openedAt) >= breakerCooldown {
+			h.State = BreakerHalfOpen
+		}
+	}
+	return h
+}
+
+// FinanceClient calls the Python finance API with retries and a circuit breaker.
+type FinanceClient struct {
+	baseURL string
+	http    *http.Client
+	breaker circuitBreaker
+}
+
+// NewFinanceClient returns a client for the finance API at baseURL.
+func NewFinanceClient(baseURL string) *FinanceClient {
+	return &FinanceClient{
+		baseURL: baseURL,
+		http:    &http.Client{Timeout: financeAttemptTimeout},
+	}
+}
+
+// Health reports the state of the client's circuit breaker.
+func (c *FinanceClient) Health() FinanceHealth {
+	return c.breaker.health()
+}
+
+// Get fetches path and returns the body of a 200 response, retrying
+// transient failures with jittered backoff.
+func (c *FinanceClient) Get(ctx context.Context, path string) ([]byte, error) {
+	url := c.baseURL + path
+	if !c.breaker.allow() {
+		return nil, &FinanceError{URL: url, Kind: ErrFinanceCircuitOpen}
+	}
+
+	var err *FinanceError
+	for attempt := 1; ; attempt++ {
+		var body []byte
+		body, err = c.get(ctx, url)
+		if err == nil {
+			c.breaker.success()
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			c.breaker.release()
+			return nil, err
+		}
+		if !err.retryable() || attempt == financeMaxAttempts {
+			break
+		}
+		delay, ok := retryDelay(attempt, err.retryAfter)
+		if !ok {
+			// The service asked us to wait longer than we are willing to.
+			break
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay+financeAttemptTimeout {
+			// Not enough time left for a full attempt; don't start one
+			// only to have it cancelled halfway.
+			break
+		}
+		log.Printf("finance API attempt %d failed, retrying: %v", attempt, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			c.breaker.release()
+			return nil, err
+		}
+	}
+
+	if err.tripsBreaker() {
+		c.breaker.failure(err)
+	} else {
+		// The service answered, so it is healthy even if this lookup failed.
+		c.breaker.success()
+	}
+	return nil, err
+}
+
+// get performs a single request.
+func (c *FinanceClient) get(ctx context.Context, url string) ([]byte, *FinanceError) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, &FinanceError{URL: url, Kind: ErrFinanceBadResponse, Err: err}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		kind := ErrFinanceUnavailable
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			kind = ErrFinanceTimeout
+		}
+		return nil, &FinanceError{URL: url, Kind: kind, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("finance API non-OK response: status=%d url=%s body=%s", resp.StatusCode, url, string(body))
+		ferr := &FinanceError{URL: url, Status: resp.StatusCode, Kind: ErrFinanceUpstream}
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			ferr.Kind = ErrFinanceNotFound
+		case resp.StatusCode == http.StatusTooManyRequests:
+			ferr.Kind = ErrFinanceRateLimited
+			ferr.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		case resp.StatusCode < 500:
+			ferr.Kind = ErrFinanceBadResponse
+		}
+		return nil, ferr
+	}
+	if err != nil {
+		return nil, &FinanceError{URL: url, Kind: ErrFinanceUnavailable, Err: err}
+	}
+	return body, nil
+}
+
+// retryDelay is the wait before retry number attempt: full jitter over an
+// exponential backoff, but never less than a server-requested Retry-After. It
+// reports false when Retry-After is longer than financeMaxBackoff, meaning the
+// caller should give up rather than retry early.
+func retryDelay(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if retryAfter > financeMaxBackoff {
+		return 0, false
+	}
+	ceiling := min(financeBackoff<<(attempt-1), financeMaxBackoff)
+	return max(rand.N(ceiling)+1, retryAfter), true
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds.
+func parseRetryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFinanceClientGet(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    map[string]string
+		wantErr   error
+		wantCalls int32
+	}{
+		{name: "ok", status: http.StatusOK, wantCalls: 1},
+		{name: "not found is not retried", status: http.StatusNotFound, wantErr: ErrFinanceNotFound, wantCalls: 1},
+		{name: "bad request is not retried", status: http.StatusBadRequest, wantErr: ErrFinanceBadResponse, wantCalls: 1},
+		{name: "server error is retried", status: http.StatusBadGateway, wantErr: ErrFinanceUpstream, wantCalls: financeMaxAttempts},
+		{
+			name:      "rate limit is retried",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"Retry-After": "0"},
+			wantErr:   ErrFinanceRateLimited,
+			wantCalls: financeMaxAttempts,
+		},
+		{
+			name:      "rate limit past the backoff budget is not retried",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"Retry-After": "30"},
+			wantErr:   ErrFinanceRateLimited,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"ok":true}`))
+			}))
+			defer srv.Close()
+
+			body, err := NewFinanceClient(srv.URL).Get(context.Background(), "/api/stocks/AAPL")
+			if tt.wantErr == nil {
+				if err != nil || string(body) != `{"ok":true}` {
+					t.Fatalf("Get() = %q, %v; want body, nil", body, err)
+				}
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v; want %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server saw %d calls; want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFinanceClientUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	_, err := NewFinanceClient(url).Get(context.Background(), "/api/stocks/AAPL")
+	if !errors.Is(err, ErrFinanceUnavailable) {
+		t.Fatalf("Get() error = %v; want %v", err, ErrFinanceUnavailable)
+	}
+}
+
+func TestFinanceClientSkipsRetryPastDeadline(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), financeAttemptTimeout/2)
+	defer cancel()
+	_, err := NewFinanceClient(srv.URL).Get(ctx, "/api/stocks/AAPL")
+	if !errors.Is(err, ErrFinanceUpstream) {
+		t.Fatalf("Get() error = %v; want %v", err, ErrFinanceUpstream)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server saw %d calls; want 1", got)
+	}
+}
+
+func TestFinanceRetryBudgetFitsFetchTimeout(t *testing.T) {
+	if financeRetryBudget >= financeFetchTimeout {
+		t.Fatalf("retry budget %s does not fit in fetch timeout %s", financeRetryBudget, financeFetchTimeout)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		min, max   time.Duration
+		wantOK     bool
+	}{
+		{attempt: 1, min: 1, max: financeBackoff, wantOK: true},
+		{attempt: 2, min: 1, max: 2 * financeBackoff, wantOK: true},
+		{attempt: 10, min: 1, max: financeMaxBackoff, wantOK: true},
+		{attempt: 1, retryAfter: 500 * time.Millisecond, min: 500 * time.Millisecond, max: 500 * time.Millisecond, wantOK: true},
+		{attempt: 1, retryAfter: financeMaxBackoff, min: financeMaxBackoff, max: financeMaxBackoff, wantOK: true},
+		{attempt: 1, retryAfter: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			d, ok := retryDelay(tt.attempt, tt.retryAfter)
+			if ok != tt.wantOK {
+				t.Fatalf("retryDelay(%d, %s) ok = %v; want %v", tt.attempt, tt.retryAfter, ok, tt.wantOK)
+			}
+			if ok && (d < tt.min || d > tt.max) {
+				t.Fatalf("retryDelay(%d, %s) = %s; want within [%s, %s]", tt.attempt, tt.retryAfter, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	failure := &FinanceError{Kind: ErrFinanceUpstream}
+	tests := []struct {
+		name      string
+		failures  int
+		openedAgo time.Duration
+		probing   bool
+		wantAllow bool
+		wantState string
+	}{
+		{name: "closed", failures: breakerThreshold - 1, wantAllow: true, wantState: BreakerClosed},
+		{name: "open", failures: breakerThreshold, wantAllow: false, wantState: BreakerOpen},
+		{name: "cooled down admits a probe", failures: breakerThreshold, openedAgo: breakerCooldown, wantAllow: true, wantState: BreakerHalfOpen},
+		{name: "one probe at a time", failures: breakerThreshold, openedAgo: breakerCooldown, probing: true, wantAllow: false, wantState: BreakerHalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b circuitBreaker
+			for range tt.failures {
+				b.failure(failure)
+			}
+			b.openedAt = b.openedAt.Add(-tt.openedAgo)
+			b.probing = tt.probing
+
+			if got := b.allow(); got != tt.wantAllow {
+				t.Errorf("allow() = %v; want %v", got, tt.wantAllow)
+			}
+			if got := b.health().State; got != tt.wantState {
+				t.Errorf("state = %q; want %q", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerProbeOutcome(t *testing.T) {
+	failure := &FinanceError{Kind: ErrFinanceUpstream}
+	open := func() *circuitBreaker {
+		b := &circuitBreaker{}
+		for range breakerThreshold {
+			b.failure(failure)
+		}
+		b.openedAt = time.Now().Add(-breakerCooldown)
+		if !b.allow() {
+			t.Fatal("cooled-down breaker did not admit a probe")
+		}
+		return b
+	}
+
+	b := open()
+	b.success()
+	if got := b.health().State; got != BreakerClosed {
+		t.Errorf("after successful probe state = %q; want %q", got, BreakerClosed)
+	}
+
+	b = open()
+	b.failure(failure)
+	if b.allow() {
+		t.Error("breaker admitted a request right after a failed probe")
+	}
+}
+
+func TestFinanceClientOpensBreaker(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := NewFinanceClient(srv.URL)
+	for range breakerThreshold {
+		client.Get(context.Background(), "/api/stocks/AAPL")
+	}
+	before := calls.Load()
+	_, err := client.Get(context.Background(), "/api/stocks/AAPL")
+	if !errors.Is(err, ErrFinanceCircuitOpen) {
+		t.Fatalf("Get() error = %v; want %v", err, ErrFinanceCircuitOpen)
+	}
+	if calls.Load() != before {
+		t.Error("open breaker still called the finance API")
+	}
+	if got := client.Health().State; got != BreakerOpen {
+		t.Errorf("Health().State = %q; want %q", got, BreakerOpen)
+	}
+}
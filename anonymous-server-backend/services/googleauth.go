@@ -4,6 +4,7 @@ package services
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/zelshahawy/Anonymous_backend/config"
@@ -13,8 +14,19 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// ErrUserNotFound is returned when no user matches the query.
-var ErrUserNotFound = errors.New("user not found")
+var (
+	// ErrUserNotFound is returned when no user matches the query.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrReservedUsername is returned when registering a name the server uses itself.
+	ErrReservedUsername = errors.New("username is reserved")
+)
+
+// IsReservedUsername reports whether name collides with an ID the server uses
+// for itself: the bot's sender ID or a room ID. Messages are looked up by
+// these IDs, so a user holding one could read other people's conversations.
+func IsReservedUsername(name string) bool {
+	return strings.EqualFold(name, BotSender) || IsRoomID(strings.ToLower(name))
+}
 
 // UserDoc represents a user record in MongoDB.
 type UserDoc struct {
@@ -49,6 +61,9 @@ func FindUserByGoogleID(ctx context.Context, googleID string) (*UserDoc, error)
 
 // CreateExternalUser creates a new user linked to a GoogleID and hashes the password.
 func CreateExternalUser(ctx context.Context, googleID, email, username, password string) (*UserDoc, error) {
+	if IsReservedUsername(username) {
+		return nil, ErrReservedUsername
+	}
 	col := usersCollection()
 
 	// Ensure username is unique
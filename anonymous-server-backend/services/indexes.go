@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+)
+
+// EnsureIndexes creates the indexes the chat store relies on. It is safe to
+// call on every startup; existing indexes are left untouched.
+func EnsureIndexes(ctx context.Context) error {
+	_, err := config.DBClients.MessagesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "msgId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "from", Value: 1}, {Key: "to", Value: 1}, {Key: "msgId", Value: -1}}},
+		{Keys: bson.D{{Key: "to", Value: 1}, {Key: "msgId", Value: -1}}},
+		{
+			Keys: bson.D{{Key: "from", Value: 1}, {Key: "nonce", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+				bson.M{"nonce": bson.M{"$type": "string"}},
+			),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = roomsCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "roomId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "members.userId", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = alertsCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "alertId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "active", Value: 1}, {Key: "symbol", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = watchlistsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = digestsCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "nextRunAt", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = portfoliosCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tradesCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "executedAt", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tokensCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
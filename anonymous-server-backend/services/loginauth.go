@@ -24,14 +24,19 @@ type LoginRequest struct {
 var secretInput = config.Config().GetString("secret_key")
 var SecretKey = []byte(secretInput)
 
-// generateJWTToken generates a JWT token for the given user
-func GenerateJWTToken(user User) (string, error) {
+// generateJWTToken generates a JWT token for the given user and records its
+// JTI so it can be revoked later
+func GenerateJWTToken(ctx context.Context, user User) (string, error) {
 	jti := ulid.Make().String()
+	issued := time.Now()
+	exp := issued.Add(24 * time.Hour)
 	claims := jwt.StandardClaims{
 		Id:        jti,
 		Subject:   user.Username,
-		ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-		IssuedAt:  time.Now().Unix(),
+		Issuer:    tokenIssuer,
+		Audience:  tokenAudience,
+		ExpiresAt: exp.Unix(),
+		IssuedAt:  issued.Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -39,6 +44,9 @@ func GenerateJWTToken(user User) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %v", err)
 	}
+	if err := RecordJTI(ctx, jti, user.Username, issued, exp); err != nil {
+		return "", fmt.Errorf("failed to record token: %v", err)
+	}
 	return tokenString, nil
 }
 
@@ -66,30 +74,6 @@ func (lr *LoginRequest) Validate() error {
 	return nil
 }
 
-func ValidateToken(tokenString string) (*jwt.StandardClaims, error) {
-	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.StandardClaims{}, func(t *jwt.Token) (any, error) {
-		// Ensure the token is signed with HMAC
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return SecretKey, nil
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %v", err)
-	}
-
-	if claims, ok := token.Claims.(*jwt.StandardClaims); ok && token.Valid {
-		if IsJTIRevoked(claims.Id) {
-			return nil, fmt.Errorf("token revoked")
-		}
-		return claims, nil
-	}
-
-	return nil, fmt.Errorf("invalid token")
-}
-
 // ProcessLogin looks up the user, checks bcrypt, and returns a JWT.
 func ProcessLogin(req LoginRequest) (LoginResponse, error) {
 	if err := req.Validate(); err != nil {
@@ -120,7 +104,7 @@ func ProcessLogin(req LoginRequest) (LoginResponse, error) {
 
 	// 4) Generate JWT
 	svcUser := User{Username: userDoc.Username}
-	token, err := GenerateJWTToken(svcUser)
+	token, err := GenerateJWTToken(ctx, svcUser)
 	if err != nil {
 		return LoginResponse{}, err
 	}
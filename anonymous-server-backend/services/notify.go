@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+// NotifyUser sends userID a message from the bot outside of any conversation
+// they started, e.g. a triggered alert. It is stored first so users who are
+// offline see it as unread on their next connection.
+func NotifyUser(ctx context.Context, userID, body string, payload *hub.Payload) {
+	msg := &hub.Message{
+		Type:      "bot",
+		Messageid: hub.GenerateMessageID(),
+		From:      BotSender,
+		To:        userID,
+		Body:      body,
+		Payload:   payload,
+	}
+
+	if err := SaveMessage(ctx, &MessageDoc{
+		MsgID:    msg.Messageid,
+		From:     msg.From,
+		To:       msg.To,
+		Body:     msg.Body,
+		Type:     msg.Type,
+		Payload:  msg.Payload,
+		Notified: hub.GlobalHub.IsUserConnected(userID),
+	}); err != nil {
+		log.Printf("failed to save bot notification for %s: %v", userID, err)
+	}
+	hub.GlobalHub.Send(userID, msg)
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+// legacyChartPrefix marks bot bodies saved before charts moved to payloads.
+const legacyChartPrefix = "CHART_DATA:"
+
+// QuotePayload is the data of a hub.PayloadQuote payload.
+type QuotePayload struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+	Change float64 `json:"change"`
+	EMA20  float64 `json:"ema20"`
+}
+
+// ChartPoint is one closing price in a chart series.
+type ChartPoint struct {
+	Date  string  `json:"date"`
+	Close float64 `json:"close"`
+}
+
+// ChartPayload is the data of a hub.PayloadChart payload.
+type ChartPayload struct {
+	Symbol string       `json:"symbol"`
+	Period string       `json:"period"`
+	Points []ChartPoint `json:"points"`
+}
+
+// CompareSeries is one symbol's performance in a comparison chart.
+type CompareSeries struct {
+	Symbol string       `json:"symbol"`
+	Points []ChartPoint `json:"points"`
+}
+
+// ComparePayload is the data of a hub.PayloadCompare payload. Every series
+// is rebased so its first close is 100.
+type ComparePayload struct {
+	Period string          `json:"period"`
+	Series []CompareSeries `json:"series"`
+}
+
+// NewsItem is one headline in a news list.
+type NewsItem struct {
+	Title  string `json:"title"`
+	URL    string `json:"url,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// NewsPayload is the data of a hub.PayloadNews payload.
+type NewsPayload struct {
+	Symbol string     `json:"symbol,omitempty"`
+	Items  []NewsItem `json:"items"`
+}
+
+// TablePayload is the data of a hub.PayloadTable payload.
+type TablePayload struct {
+	Title   string     `json:"title"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// botReply builds a single bot response carrying a structured payload. If
+// data cannot be encoded the text body is still sent on its own.
+func botReply(body, kind string, data any) []BotResponse {
+	payload, err := hub.NewPayload(kind, data)
+	if err != nil {
+		log.Printf("failed to encode %s payload: %v", kind, err)
+	}
+	return []BotResponse{{From: "bot", Body: body, Payload: payload}}
+}
+
+// DisplayPayload returns the body and payload a stored message should be
+// shown with. Bot charts saved as "CHART_DATA:" bodies are upgraded so
+// history renders the same as a fresh reply.
+func (m *MessageDoc) DisplayPayload() (string, *hub.Payload) {
+	if m.Payload != nil || m.Type != "bot" || !strings.HasPrefix(m.Body, legacyChartPrefix) {
+		return m.Body, m.Payload
+	}
+	var chart ChartPayload
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(m.Body, legacyChartPrefix)), &chart); err != nil {
+		return m.Body, nil
+	}
+	payload, err := hub.NewPayload(hub.PayloadChart, chart)
+	if err != nil {
+		return m.Body, nil
+	}
+	return chartSummary(&chart), payload
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+const (
+	// TradeBuy and TradeSell are the sides of a paper trade.
+	TradeBuy  = "buy"
+	TradeSell = "sell"
+
+	// startingCash is the simulated balance every new portfolio gets.
+	startingCash = 100_000.0
+	// maxTradeAttempts bounds retries when a concurrent trade changed the portfolio.
+	maxTradeAttempts = 3
+	// maxTradeQuantity and maxPositionQuantity cap shares per trade and per
+	// holding, keeping quantities and their cost far from overflowing.
+	maxTradeQuantity    = 1_000_000
+	maxPositionQuantity = 10_000_000
+)
+
+var (
+	// ErrInsufficientCash is returned when a buy costs more than the cash balance.
+	ErrInsufficientCash = errors.New("insufficient cash")
+	// ErrInsufficientShares is returned when selling more shares than are held.
+	ErrInsufficientShares = errors.New("insufficient shares")
+	// ErrInvalidTrade is returned for a quantity outside 1..maxTradeQuantity or
+	// a price that is not a finite positive number.
+	ErrInvalidTrade = errors.New("invalid trade")
+	// ErrPositionTooLarge is returned when a buy would take a holding past
+	// maxPositionQuantity shares.
+	ErrPositionTooLarge = errors.New("position too large")
+	// errPortfolioConflict is returned when the portfolio changed mid-trade.
+	errPortfolioConflict = errors.New("portfolio changed concurrently")
+)
+
+// Position is a holding in a paper-trading portfolio.
+type Position struct {
+	Symbol   string  `bson:"symbol"`
+	Quantity int64   `bson:"quantity"`
+	AvgCost  float64 `bson:"avgCost"`
+}
+
+// PortfolioDoc is a user's paper-trading account. Version guards against
+// concurrent trades overwriting each other.
+type PortfolioDoc struct {
+	UserID      string     `bson:"userId"`
+	Cash        float64    `bson:"cash"`
+	Positions   []Position `bson:"positions"`
+	RealizedPnL float64    `bson:"realizedPnl"`
+	Version     int64      `bson:"version"`
+	CreatedAt   time.Time  `bson:"createdAt"`
+	UpdatedAt   time.Time  `bson:"updatedAt"`
+}
+
+// position returns the holding for symbol, or nil.
+func (p *PortfolioDoc) position(symbol string) *Position {
+	for i := range p.Positions {
+		if p.Positions[i].Symbol == symbol {
+			return &p.Positions[i]
+		}
+	}
+	return nil
+}
+
+// TradeDoc records one simulated fill.
+type TradeDoc struct {
+	UserID      string    `bson:"userId"`
+	Symbol      string    `bson:"symbol"`
+	Side        string    `bson:"side"`
+	Quantity    int64     `bson:"quantity"`
+	Price       float64   `bson:"price"`
+	RealizedPnL float64   `bson:"realizedPnl,omitempty"`
+	ExecutedAt  time.Time `bson:"executedAt"`
+}
+
+// portfoliosCollection returns the MongoDB collection handle for portfolios.
+func portfoliosCollection() *mongo.Collection {
+	dbName := config.Configuration.Database
+	return config.DBClients.MongoClient.Database(dbName).Collection("portfolios")
+}
+
+// tradesCollection returns the MongoDB collection handle for the trade log.
+func tradesCollection() *mongo.Collection {
+	dbName := config.Configuration.Database
+	return config.DBClients.MongoClient.Database(dbName).Collection("trades")
+}
+
+// LoadPortfolio returns userID's portfolio, opening one with startingCash
+// on first use.
+func LoadPortfolio(ctx context.Context, userID string) (*PortfolioDoc, error) {
+	now := time.Now()
+	var p PortfolioDoc
+	err := portfoliosCollection().FindOneAndUpdate(ctx,
+		bson.M{"userId": userID},
+		bson.M{"$setOnInsert": bson.M{
+			"cash":        startingCash,
+			"positions":   bson.A{},
+			"realizedPnl": 0.0,
+			"version":     int64(0),
+			"createdAt":   now,
+			"updatedAt":   now,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ExecuteTrade fills a paper trade of quantity shares at price and returns
+// the updated portfolio along with the recorded trade.
+func ExecuteTrade(ctx context.Context, userID, side, symbol string, quantity int64, price float64) (*PortfolioDoc, *TradeDoc, error) {
+	if err := validateTrade(quantity, price); err != nil {
+		return nil, nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		p, trade, err := tryTrade(ctx, userID, side, symbol, quantity, price)
+		if !errors.Is(err, errPortfolioConflict) || attempt == maxTradeAttempts {
+			return p, trade, err
+		}
+	}
+}
+
+func tryTrade(ctx context.Context, userID, side, symbol string, quantity int64, price float64) (*PortfolioDoc, *TradeDoc, error) {
+	p, err := LoadPortfolio(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trade := &TradeDoc{
+		UserID:     userID,
+		Symbol:     symbol,
+		Side:       side,
+		Quantity:   quantity,
+		Price:      price,
+		ExecutedAt: time.Now(),
+	}
+	if err := applyTrade(p, trade); err != nil {
+		return p, nil, err
+	}
+
+	res, err := portfoliosCollection().UpdateOne(ctx,
+		bson.M{"userId": userID, "version": p.Version},
+		bson.M{
+			"$set": bson.M{
+				"cash":        p.Cash,
+				"positions":   p.Positions,
+				"realizedPnl": p.RealizedPnL,
+				"updatedAt":   trade.ExecutedAt,
+			},
+			"$inc": bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.ModifiedCount == 0 {
+		return nil, nil, errPortfolioConflict
+	}
+	p.Version++
+
+	if _, err := tradesCollection().InsertOne(ctx, trade); err != nil {
+		log.Printf("failed to record %s trade for %s: %v", side, userID, err)
+	}
+	return p, trade, nil
+}
+
+// validateTrade checks a fill's quantity and price before the portfolio is
+// touched. The finance API reports 0 for symbols it cannot price.
+func validateTrade(quantity int64, price float64) error {
+	switch {
+	case quantity <= 0 || quantity > maxTradeQuantity:
+		return fmt.Errorf("%w: quantity %d", ErrInvalidTrade, quantity)
+	case math.IsNaN(price) || math.IsInf(price, 0) || price <= 0:
+		return fmt.Errorf("%w: price %v", ErrInvalidTrade, price)
+	}
+	return nil
+}
+
+// applyTrade fills trade against p in memory, updating cash, the position and
+// realized P&L. trade.RealizedPnL is set for sells.
+func applyTrade(p *PortfolioDoc, trade *TradeDoc) error {
+	if err := validateTrade(trade.Quantity, trade.Price); err != nil {
+		return err
+	}
+	quantity, price := trade.Quantity, trade.Price
+	amount := float64(quantity) * price
+	pos := p.position(trade.Symbol)
+
+	switch trade.Side {
+	case TradeBuy:
+		if amount > p.Cash {
+			return ErrInsufficientCash
+		}
+		if pos != nil && quantity > maxPositionQuantity-pos.Quantity {
+			return ErrPositionTooLarge
+		}
+		p.Cash -= amount
+		if pos == nil {
+			p.Positions = append(p.Positions, Position{Symbol: trade.Symbol})
+			pos = &p.Positions[len(p.Positions)-1]
+		}
+		pos.AvgCost = (float64(pos.Quantity)*pos.AvgCost + amount) / float64(pos.Quantity+quantity)
+		pos.Quantity += quantity
+
+	case TradeSell:
+		if pos == nil || pos.Quantity < quantity {
+			return ErrInsufficientShares
+		}
+		trade.RealizedPnL = (price - pos.AvgCost) * float64(quantity)
+		p.Cash += amount
+		p.RealizedPnL += trade.RealizedPnL
+		pos.Quantity -= quantity
+		if pos.Quantity == 0 {
+			kept := p.Positions[:0]
+			for _, q := range p.Positions {
+				if q.Quantity > 0 {
+					kept = append(kept, q)
+				}
+			}
+			p.Positions = kept
+		}
+	}
+	return nil
+}
+
+func init() {
+	tradeArgs := []CommandArg{{Name: "SYMBOL", Required: true}, {Name: "QUANTITY", Required: true}}
+	RegisterCommand(Command{
+		Name:        "buy",
+		Args:        tradeArgs,
+		Description: "Paper-trade: buy shares at the current price",
+		Example:     "/buy AAPL 10",
+		Handler:     HandleBuyCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "sell",
+		Args:        tradeArgs,
+		Description: "Paper-trade: sell shares at the current price",
+		Example:     "/sell AAPL 5",
+		Handler:     HandleSellCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "portfolio",
+		Aliases:     []string{"pf"},
+		Description: "Show your paper-trading positions and P&L",
+		Handler:     HandlePortfolioCommand,
+	})
+}
+
+// HandleBuyCommand fills a simulated buy order
+func HandleBuyCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	return handleTrade(ctx, in, TradeBuy, args)
+}
+
+// HandleSellCommand fills a simulated sell order
+func HandleSellCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	return handleTrade(ctx, in, TradeSell, args)
+}
+
+func handleTrade(ctx context.Context, in *hub.Message, side string, args []string) []BotResponse {
+	sym, err := ParseSymbol(args[0])
+	if err != nil {
+		return invalidSymbolReply(args[0])
+	}
+	quantity, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || quantity <= 0 || quantity > maxTradeQuantity {
+		cmd, _ := Commands.Lookup(side)
+		return []BotResponse{{From: "bot", Body: usageReply(cmd) +
+			fmt.Sprintf(" QUANTITY is a whole number of shares, at most %d.", maxTradeQuantity)}}
+	}
+
+	quote, err := fetchLiveStock(ctx, sym)
+	if err != nil {
+		return []BotResponse{{From: "bot", Body: friendlyError(sym, err)}}
+	}
+
+	p, trade, err := ExecuteTrade(ctx, in.From, side, sym, quantity, quote.Price)
+	switch {
+	case errors.Is(err, ErrInsufficientCash):
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("Not enough cash: %d × **%s** at $%.2f costs $%.2f, you have $%.2f.",
+			quantity, sym, quote.Price, float64(quantity)*quote.Price, p.Cash)}}
+	case errors.Is(err, ErrPositionTooLarge):
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("A position can hold at most %d shares of **%s**.", maxPositionQuantity, sym)}}
+	case errors.Is(err, ErrInvalidTrade):
+		// Quantity was checked above, so the quote had no usable price.
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("Couldn't get a valid price for **%s**, so no trade was placed.", sym)}}
+	case errors.Is(err, ErrInsufficientShares):
+		held := int64(0)
+		if pos := p.position(sym); pos != nil {
+			held = pos.Quantity
+		}
+		return []BotResponse{{From: "bot", Body: fmt.Sprintf("You only hold %d **%s**.", held, sym)}}
+	case err != nil:
+		log.Printf("failed to %s %s for %s: %v", side, sym, in.From, err)
+		return []BotResponse{{From: "bot", Body: "Couldn't place that trade. Try again in a moment!"}}
+	}
+
+	verb := "Bought"
+	if side == TradeSell {
+		verb = "Sold"
+	}
+	text := fmt.Sprintf("✅ %s %d **%s** @ $%.2f ($%.2f). Cash: $%.2f",
+		verb, quantity, sym, trade.Price, float64(quantity)*trade.Price, p.Cash)
+	if side == TradeSell {
+		text += fmt.Sprintf("  Realized P&L: %s", formatPnL(trade.RealizedPnL))
+	}
+	return []BotResponse{{From: "bot", Body: text}}
+}
+
+// HandlePortfolioCommand values the sender's positions at current prices
+func HandlePortfolioCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	p, err := LoadPortfolio(ctx, in.From)
+	if err != nil {
+		log.Printf("failed to load portfolio for %s: %v", in.From, err)
+		return []BotResponse{{From: "bot", Body: "Couldn't load your portfolio. Try again in a moment!"}}
+	}
+
+	symbols := make([]string, len(p.Positions))
+	for i, pos := range p.Positions {
+		symbols[i] = pos.Symbol
+	}
+	quotes, _ := fetchQuotes(ctx, symbols)
+
+	lines := []string{"💼 **Your Portfolio:**", ""}
+	table := TablePayload{
+		Title:   "Your Portfolio",
+		Columns: []string{"Symbol", "Qty", "Avg Cost", "Price", "Value", "Unrealized P&L"},
+	}
+	equity, unrealized := p.Cash, 0.0
+	for i, pos := range p.Positions {
+		if quotes[i] == nil {
+			lines = append(lines, fmt.Sprintf("• **%s** %d @ $%.2f (price unavailable)", pos.Symbol, pos.Quantity, pos.AvgCost))
+			table.Rows = append(table.Rows, []string{pos.Symbol, strconv.FormatInt(pos.Quantity, 10), fmt.Sprintf("%.2f", pos.AvgCost), "", "", ""})
+			equity += float64(pos.Quantity) * pos.AvgCost
+			continue
+		}
+		price := quotes[i].Price
+		value := float64(pos.Quantity) * price
+		pnl := (price - pos.AvgCost) * float64(pos.Quantity)
+		equity += value
+		unrealized += pnl
+		lines = append(lines, fmt.Sprintf("• **%s** %d @ $%.2f → $%.2f  %s", pos.Symbol, pos.Quantity, pos.AvgCost, price, formatPnL(pnl)))
+		table.Rows = append(table.Rows, []string{
+			pos.Symbol, strconv.FormatInt(pos.Quantity, 10), fmt.Sprintf("%.2f", pos.AvgCost),
+			fmt.Sprintf("%.2f", price), fmt.Sprintf("%.2f", value), fmt.Sprintf("%+.2f", pnl),
+		})
+	}
+	if len(p.Positions) == 0 {
+		lines = append(lines, "No positions yet. Try `/buy AAPL 10`.")
+	}
+	lines = append(lines, "",
+		fmt.Sprintf("Cash: $%.2f", p.Cash),
+		fmt.Sprintf("Equity: $%.2f", equity),
+		fmt.Sprintf("Unrealized P&L: %s", formatPnL(unrealized)),
+		fmt.Sprintf("Realized P&L: %s", formatPnL(p.RealizedPnL)),
+	)
+	return botReply(strings.Join(lines, "\n"), hub.PayloadTable, table)
+}
+
+// formatPnL renders a profit or loss with a colored marker.
+func formatPnL(v float64) string {
+	if math.Abs(v) < 0.005 {
+		return "$0.00"
+	}
+	if v > 0 {
+		return fmt.Sprintf("🟢 +$%.2f", v)
+	}
+	return fmt.Sprintf("🔴 -$%.2f", -v)
+}
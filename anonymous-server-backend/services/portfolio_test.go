@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestApplyTrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		held     int64 // AAPL shares held at $100 before the trade
+		side     string
+		quantity int64
+		price    float64
+		wantErr  error
+		wantCash float64
+		wantHeld int64
+		wantAvg  float64
+		wantPnL  float64
+	}{
+		{name: "buy", side: TradeBuy, quantity: 10, price: 50, wantCash: startingCash - 500, wantHeld: 10, wantAvg: 50},
+		{name: "buy averages cost", held: 10, side: TradeBuy, quantity: 10, price: 200, wantCash: startingCash - 2000, wantHeld: 20, wantAvg: 150},
+		{name: "sell realizes P&L", held: 10, side: TradeSell, quantity: 4, price: 120, wantCash: startingCash + 480, wantHeld: 6, wantAvg: 100, wantPnL: 80},
+		{name: "sell closes position", held: 10, side: TradeSell, quantity: 10, price: 90, wantCash: startingCash + 900, wantPnL: -100},
+		{name: "zero price", side: TradeBuy, quantity: 10, price: 0, wantErr: ErrInvalidTrade},
+		{name: "negative price", side: TradeBuy, quantity: 10, price: -1, wantErr: ErrInvalidTrade},
+		{name: "NaN price", side: TradeBuy, quantity: 10, price: math.NaN(), wantErr: ErrInvalidTrade},
+		{name: "infinite price", held: 10, side: TradeSell, quantity: 1, price: math.Inf(1), wantErr: ErrInvalidTrade},
+		{name: "zero quantity", side: TradeBuy, quantity: 0, price: 1, wantErr: ErrInvalidTrade},
+		{name: "quantity over trade cap", side: TradeBuy, quantity: maxTradeQuantity + 1, price: 0.0001, wantErr: ErrInvalidTrade},
+		{name: "position over cap", held: maxPositionQuantity, side: TradeBuy, quantity: 1, price: 0.0001, wantErr: ErrPositionTooLarge},
+		{name: "position would overflow", held: math.MaxInt64 - 1, side: TradeBuy, quantity: 10, price: 0.0001, wantErr: ErrPositionTooLarge},
+		{name: "insufficient cash", side: TradeBuy, quantity: 1001, price: 100, wantErr: ErrInsufficientCash},
+		{name: "insufficient shares", held: 5, side: TradeSell, quantity: 6, price: 100, wantErr: ErrInsufficientShares},
+		{name: "sell with no position", side: TradeSell, quantity: 1, price: 100, wantErr: ErrInsufficientShares},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &PortfolioDoc{Cash: startingCash}
+			if tt.held > 0 {
+				p.Positions = []Position{{Symbol: "AAPL", Quantity: tt.held, AvgCost: 100}}
+			}
+			before := *p
+			trade := &TradeDoc{Symbol: "AAPL", Side: tt.side, Quantity: tt.quantity, Price: tt.price}
+
+			err := applyTrade(p, trade)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyTrade() error = %v; want %v", err, tt.wantErr)
+				}
+				if p.Cash != before.Cash || len(p.Positions) != len(before.Positions) {
+					t.Errorf("rejected trade changed the portfolio: %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyTrade() error = %v", err)
+			}
+
+			var held int64
+			var avg float64
+			if pos := p.position("AAPL"); pos != nil {
+				held, avg = pos.Quantity, pos.AvgCost
+			}
+			got := []float64{p.Cash, float64(held), avg, trade.RealizedPnL, p.RealizedPnL}
+			want := []float64{tt.wantCash, float64(tt.wantHeld), tt.wantAvg, tt.wantPnL, tt.wantPnL}
+			if !approxEqual(got, want) {
+				t.Errorf("cash, held, avg cost, trade P&L, realized P&L = %v; want %v", got, want)
+			}
+		})
+	}
+}
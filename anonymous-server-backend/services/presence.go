@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+)
+
+// PresencePeers returns the users allowed to see userID's presence: everyone
+// they have a direct conversation with and every member of their rooms.
+func PresencePeers(ctx context.Context, userID string) ([]string, error) {
+	col := config.DBClients.MessagesCollection
+	notRoom := bson.M{"$not": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(RoomIDPrefix)}}
+
+	sentTo, err := col.Distinct(ctx, "to", bson.M{"from": userID, "to": notRoom})
+	if err != nil {
+		return nil, err
+	}
+	heardFrom, err := col.Distinct(ctx, "from", bson.M{"to": userID})
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := LoadUserRooms(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{userID: true, BotSender: true}
+	var peers []string
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			peers = append(peers, id)
+		}
+	}
+	for _, v := range append(sentTo, heardFrom...) {
+		if id, ok := v.(string); ok {
+			add(id)
+		}
+	}
+	for i := range rooms {
+		for _, id := range rooms[i].MemberIDs() {
+			add(id)
+		}
+	}
+	return peers, nil
+}
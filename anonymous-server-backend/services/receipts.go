@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+)
+
+// ErrMessageNotFound is returned when no message matches the given ID.
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrNotRecipient is returned when a user acknowledges a message not addressed to them.
+var ErrNotRecipient = errors.New("not a recipient of this message")
+
+// Receipt records when a single recipient received and read a message.
+type Receipt struct {
+	UserID      string     `bson:"userId"`
+	DeliveredAt *time.Time `bson:"deliveredAt,omitempty"`
+	ReadAt      *time.Time `bson:"readAt,omitempty"`
+}
+
+// FindMessage looks up a message by its ULID.
+func FindMessage(ctx context.Context, msgID string) (*MessageDoc, error) {
+	var doc MessageDoc
+	err := config.DBClients.MessagesCollection.FindOne(ctx, bson.M{"msgId": msgID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// isRecipient reports whether userID is addressed by the message, either
+// directly or as a member of the room it was sent to.
+func isRecipient(ctx context.Context, doc *MessageDoc, userID string) (bool, error) {
+	if doc.From == userID {
+		return false, nil
+	}
+	if !IsRoomID(doc.To) {
+		return doc.To == userID, nil
+	}
+	room, err := FindRoom(ctx, doc.To)
+	if err != nil {
+		return false, err
+	}
+	return room.HasMember(userID), nil
+}
+
+// MarkMessageDelivered records that userID received msgID. It returns the
+// message and whether this call changed its receipt state.
+func MarkMessageDelivered(ctx context.Context, msgID, userID string) (*MessageDoc, bool, error) {
+	return markReceipt(ctx, msgID, userID, false)
+}
+
+// MarkMessageRead records that userID read msgID, which also implies delivery.
+// It returns the message and whether this call changed its receipt state.
+func MarkMessageRead(ctx context.Context, msgID, userID string) (*MessageDoc, bool, error) {
+	return markReceipt(ctx, msgID, userID, true)
+}
+
+func markReceipt(ctx context.Context, msgID, userID string, read bool) (*MessageDoc, bool, error) {
+	doc, err := FindMessage(ctx, msgID)
+	if err != nil {
+		return nil, false, err
+	}
+	ok, err := isRecipient(ctx, doc, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, ErrNotRecipient
+	}
+
+	col := config.DBClients.MessagesCollection
+	now := time.Now()
+
+	// Make sure the recipient has a receipt entry to update.
+	if _, err := col.UpdateOne(ctx,
+		bson.M{"msgId": msgID, "receipts.userId": bson.M{"$ne": userID}},
+		bson.M{"$push": bson.M{"receipts": Receipt{UserID: userID}}},
+	); err != nil {
+		return nil, false, err
+	}
+
+	field := "deliveredAt"
+	if read {
+		field = "readAt"
+	}
+	res, err := col.UpdateOne(ctx,
+		bson.M{
+			"msgId":    msgID,
+			"receipts": bson.M{"$elemMatch": bson.M{"userId": userID, field: nil}},
+		},
+		bson.M{"$set": bson.M{"receipts.$." + field: now}},
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := res.ModifiedCount > 0
+
+	if read {
+		// Reading implies delivery and clears the offline notification.
+		if _, err := col.UpdateOne(ctx,
+			bson.M{
+				"msgId":    msgID,
+				"receipts": bson.M{"$elemMatch": bson.M{"userId": userID, "deliveredAt": nil}},
+			},
+			bson.M{"$set": bson.M{"receipts.$.deliveredAt": now}},
+		); err != nil {
+			return nil, false, err
+		}
+		if !IsRoomID(doc.To) {
+			if _, err := col.UpdateOne(ctx, bson.M{"msgId": msgID}, bson.M{"$set": bson.M{"notified": true}}); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	return doc, changed, nil
+}
+
+// ReceiptUsers returns the users who have received and read the message.
+func (m *MessageDoc) ReceiptUsers() (delivered, read []string) {
+	for _, r := range m.Receipts {
+		if r.DeliveredAt != nil {
+			delivered = append(delivered, r.UserID)
+		}
+		if r.ReadAt != nil {
+			read = append(read, r.UserID)
+		}
+	}
+	return delivered, read
+}
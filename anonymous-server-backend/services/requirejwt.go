@@ -2,23 +2,104 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+const (
+	// tokenIssuer is the iss claim on every token this server signs.
+	tokenIssuer = "anonymous-backend"
+	// tokenAudience is the aud claim on every token this server signs.
+	tokenAudience = "anonymous-web"
+)
+
 var (
-	mu          sync.RWMutex
-	revokedJTIs = make(map[string]time.Time)
+	// ErrTokenInvalid is returned for tokens that are malformed, badly
+	// signed, missing a required claim or minted for another issuer or audience.
+	ErrTokenInvalid = errors.New("invalid token")
+	// ErrTokenExpired is returned for tokens past their exp.
+	ErrTokenExpired = errors.New("token expired")
+	// ErrTokenRevoked is returned for tokens revoked by a logout.
+	ErrTokenRevoked = errors.New("token revoked")
 )
 
 type contextKey string
 
 const userIDKey contextKey = "userID"
 
+// VerifyToken is the single check every authenticated path runs: it requires
+// an HS256 signature, unexpired exp, our issuer and audience, a subject and a
+// JTI that has not been revoked.
+func VerifyToken(ctx context.Context, tokenString string) (*jwt.StandardClaims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := isJTIRevoked(ctx, claims.Id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check revocation: %v", err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// parseToken performs every VerifyToken check except revocation.
+func parseToken(tokenString string) (*jwt.StandardClaims, error) {
+	claims := &jwt.StandardClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return SecretKey, nil
+	})
+	var verr *jwt.ValidationError
+	if errors.As(err, &verr) && verr.Errors == jwt.ValidationErrorExpired {
+		return nil, ErrTokenExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+	// ParseWithClaims only checks exp when present, so require it here.
+	switch {
+	case claims.ExpiresAt == 0:
+		return nil, fmt.Errorf("%w: missing expiry", ErrTokenInvalid)
+	case !claims.VerifyIssuer(tokenIssuer, true):
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrTokenInvalid, claims.Issuer)
+	case !claims.VerifyAudience(tokenAudience, true):
+		return nil, fmt.Errorf("%w: unexpected audience %q", ErrTokenInvalid, claims.Audience)
+	case claims.Subject == "" || claims.Id == "":
+		return nil, fmt.Errorf("%w: missing subject or JTI", ErrTokenInvalid)
+	case IsReservedUsername(claims.Subject):
+		return nil, fmt.Errorf("%w: reserved subject %q", ErrTokenInvalid, claims.Subject)
+	}
+	return claims, nil
+}
+
+// The token store calls used by VerifyToken and Logout; tests replace them.
+var (
+	isJTIRevoked = IsJTIRevoked
+	revokeJTI    = RevokeJTI
+)
+
+// Logout verifies tokenString and revokes it, returning its claims.
+func Logout(ctx context.Context, tokenString string) (*jwt.StandardClaims, error) {
+	claims, err := VerifyToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if err := revokeJTI(ctx, claims.Id, claims.Subject, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return nil, fmt.Errorf("failed to revoke token for %s: %w", claims.Subject, err)
+	}
+	return claims, nil
+}
+
 // AuthMiddleware checks for a valid auth_token cookie, verifies the JWT,
 // and injects the user ID (sub) into the request context.
 func AuthMiddleware(next http.Handler) http.Handler {
@@ -29,14 +110,9 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		claims := &jwt.StandardClaims{}
-		token, err := jwt.ParseWithClaims(c.Value, claims, func(t *jwt.Token) (any, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-			}
-			return SecretKey, nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := VerifyToken(r.Context(), c.Value)
+		if err != nil {
+			log.Printf("rejected auth_token: %v", err)
 			http.Error(w, "unauthorized - invalid token", http.StatusUnauthorized)
 			return
 		}
@@ -51,27 +127,3 @@ func UserIDFromContext(ctx context.Context) (string, bool) {
 	userID, ok := ctx.Value(userIDKey).(string)
 	return userID, ok
 }
-
-// RevokeJTI marks a JWT ID as revoked until its expiration time.
-func RevokeJTI(jti string, exp time.Time) {
-	mu.Lock()
-	revokedJTIs[jti] = exp
-	mu.Unlock()
-}
-
-// IsJTIRevoked reports true if the JTI has been revoked.
-func IsJTIRevoked(jti string) bool {
-	mu.RLock()
-	exp, ok := revokedJTIs[jti]
-	mu.RUnlock()
-	if !ok {
-		return false
-	}
-	if time.Now().After(exp) {
-		mu.Lock()
-		delete(revokedJTIs, jti)
-		mu.Unlock()
-		return false
-	}
-	return true
-}
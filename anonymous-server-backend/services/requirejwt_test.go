@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var errLookup = errors.New("mongo unavailable")
+
+// stubTokenStore replaces the token store for one test. Revocation lookups
+// answer from revoked, or fail with lookupErr when it is set.
+func stubTokenStore(t *testing.T, revoked map[string]bool, lookupErr error) *[]string {
+	t.Helper()
+	oldKey, oldLookup, oldRevoke := SecretKey, isJTIRevoked, revokeJTI
+	t.Cleanup(func() { SecretKey, isJTIRevoked, revokeJTI = oldKey, oldLookup, oldRevoke })
+
+	SecretKey = []byte("test-secret")
+	isJTIRevoked = func(ctx context.Context, jti string) (bool, error) {
+		return revoked[jti], lookupErr
+	}
+	var revokedNow []string
+	revokeJTI = func(ctx context.Context, jti, userID string, exp time.Time) error {
+		revokedNow = append(revokedNow, jti)
+		return nil
+	}
+	return &revokedNow
+}
+
+// validClaims are the claims of a token VerifyToken accepts.
+func validClaims() jwt.StandardClaims {
+	now := time.Now()
+	return jwt.StandardClaims{
+		Id:        "01JTI",
+		Subject:   "alice",
+		Issuer:    tokenIssuer,
+		Audience:  tokenAudience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, claims jwt.StandardClaims, key any) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("signing %s token: %v", method.Alg(), err)
+	}
+	return s
+}
+
+func TestVerifyToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("test-secret")
+	with := func(edit func(*jwt.StandardClaims)) jwt.StandardClaims {
+		c := validClaims()
+		edit(&c)
+		return c
+	}
+	hs256 := func(c jwt.StandardClaims) func(*testing.T) string {
+		return func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, c, secret) }
+	}
+
+	tests := []struct {
+		name      string
+		token     func(*testing.T) string
+		revoked   bool
+		lookupErr error
+		wantErr   error
+		wantMsg   string
+	}{
+		{name: "valid", token: hs256(validClaims())},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return signToken(t, jwt.SigningMethodNone, validClaims(), jwt.UnsafeAllowNoneSignatureType)
+			},
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "RS256",
+			token:   func(t *testing.T) string { return signToken(t, jwt.SigningMethodRS256, validClaims(), rsaKey) },
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "HS384",
+			token:   func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS384, validClaims(), secret) },
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "bad signature",
+			token:   func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, validClaims(), []byte("other")) },
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name: "expired with bad signature",
+			token: func(t *testing.T) string {
+				c := with(func(c *jwt.StandardClaims) { c.ExpiresAt = time.Now().Add(-time.Hour).Unix() })
+				return signToken(t, jwt.SigningMethodHS256, c, []byte("other"))
+			},
+			wantErr: ErrTokenInvalid,
+		},
+		{name: "malformed", token: func(*testing.T) string { return "not.a.jwt" }, wantErr: ErrTokenInvalid},
+		{
+			name:    "expired",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() })),
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:    "missing exp",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.ExpiresAt = 0 })),
+			wantErr: ErrTokenInvalid,
+			wantMsg: "missing expiry",
+		},
+		{
+			name:    "wrong iss",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.Issuer = "someone-else" })),
+			wantErr: ErrTokenInvalid,
+			wantMsg: "issuer",
+		},
+		{
+			name:    "missing iss",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.Issuer = "" })),
+			wantErr: ErrTokenInvalid,
+			wantMsg: "issuer",
+		},
+		{
+			name:    "wrong aud",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.Audience = "someone-else" })),
+			wantErr: ErrTokenInvalid,
+			wantMsg: "audience",
+		},
+		{
+			name:    "missing aud",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.Audience = "" })),
+			wantErr: ErrTokenInvalid,
+			wantMsg: "audience",
+		},
+		{
+			name:    "empty sub",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.Subject = "" })),
+			wantErr: ErrTokenInvalid,
+			wantMsg: "missing subject",
+		},
+		{
+			name:    "empty jti",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.Id = "" })),
+			wantErr: ErrTokenInvalid,
+			wantMsg: "JTI",
+		},
+		{
+			name:    "reserved sub",
+			token:   hs256(with(func(c *jwt.StandardClaims) { c.Subject = BotSender })),
+			wantErr: ErrTokenInvalid,
+			wantMsg: "reserved",
+		},
+		{name: "revoked jti", token: hs256(validClaims()), revoked: true, wantErr: ErrTokenRevoked},
+		{name: "revocation lookup error", token: hs256(validClaims()), lookupErr: errLookup, wantMsg: "failed to check revocation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubTokenStore(t, map[string]bool{"01JTI": tt.revoked}, tt.lookupErr)
+
+			claims, err := VerifyToken(context.Background(), tt.token(t))
+			if tt.wantErr == nil && tt.wantMsg == "" {
+				if err != nil {
+					t.Fatalf("VerifyToken() error = %v", err)
+				}
+				if claims.Subject != "alice" {
+					t.Errorf("subject = %q; want %q", claims.Subject, "alice")
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("VerifyToken() accepted the token")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v; want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("error = %q; want it to mention %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	secret := []byte("test-secret")
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name       string
+		cookie     func(*testing.T) string // empty means no cookie
+		revoked    bool
+		lookupErr  error
+		wantStatus int
+	}{
+		{name: "no cookie", cookie: func(*testing.T) string { return "" }, wantStatus: http.StatusUnauthorized},
+		{name: "bad cookie", cookie: func(*testing.T) string { return "garbage" }, wantStatus: http.StatusUnauthorized},
+		{
+			name:       "expired",
+			cookie:     func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, expired, secret) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "revoked",
+			cookie:     func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, validClaims(), secret) },
+			revoked:    true,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "lookup error",
+			cookie:     func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, validClaims(), secret) },
+			lookupErr:  errLookup,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "valid",
+			cookie:     func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, validClaims(), secret) },
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubTokenStore(t, map[string]bool{"01JTI": tt.revoked}, tt.lookupErr)
+
+			var gotUser string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUser, _ = UserIDFromContext(r.Context())
+			})
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if v := tt.cookie(t); v != "" {
+				req.AddCookie(&http.Cookie{Name: "auth_token", Value: v})
+			}
+			rec := httptest.NewRecorder()
+			AuthMiddleware(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", rec.Code, tt.wantStatus)
+			}
+			wantUser := ""
+			if tt.wantStatus == http.StatusOK {
+				wantUser = "alice"
+			}
+			if gotUser != wantUser {
+				t.Errorf("user in context = %q; want %q", gotUser, wantUser)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	secret := []byte("test-secret")
+	tests := []struct {
+		name        string
+		token       func(*testing.T) string
+		revoked     bool
+		revokeErr   error
+		wantErr     error
+		wantRevoked []string
+	}{
+		{
+			name:        "valid token is revoked",
+			token:       func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, validClaims(), secret) },
+			wantRevoked: []string{"01JTI"},
+		},
+		{
+			name:    "already revoked",
+			token:   func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, validClaims(), secret) },
+			revoked: true,
+			wantErr: ErrTokenRevoked,
+		},
+		{
+			name:    "forged token is ignored",
+			token:   func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, validClaims(), []byte("other")) },
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:      "store error",
+			token:     func(t *testing.T) string { return signToken(t, jwt.SigningMethodHS256, validClaims(), secret) },
+			revokeErr: errLookup,
+			wantErr:   errLookup,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revokedNow := stubTokenStore(t, map[string]bool{"01JTI": tt.revoked}, nil)
+			if tt.revokeErr != nil {
+				revokeJTI = func(context.Context, string, string, time.Time) error { return tt.revokeErr }
+			}
+
+			claims, err := Logout(context.Background(), tt.token(t))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Logout() error = %v; want %v", err, tt.wantErr)
+				}
+			} else if err != nil || claims.Subject != "alice" {
+				t.Errorf("Logout() = %v, %v; want alice's claims", claims, err)
+			}
+			if strings.Join(*revokedNow, ",") != strings.Join(tt.wantRevoked, ",") {
+				t.Errorf("revoked %v; want %v", *revokedNow, tt.wantRevoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+const (
+	// revocationCacheTTL bounds how long an instance trusts a "not revoked"
+	// answer. Revocations are also broadcast through the hub broker, so this
+	// only matters if that broadcast is lost.
+	revocationCacheTTL = 30 * time.Second
+	// revocationCacheSize is the number of JTIs kept before old ones are swept.
+	revocationCacheSize = 4096
+)
+
+// TokenDoc records an issued JWT so it can be revoked across instances.
+// MongoDB's TTL monitor removes it once the token has expired.
+type TokenDoc struct {
+	JTI       string     `bson:"jti"`
+	UserID    string     `bson:"userId"`
+	IssuedAt  time.Time  `bson:"issuedAt"`
+	ExpiresAt time.Time  `bson:"expiresAt"`
+	RevokedAt *time.Time `bson:"revokedAt,omitempty"`
+}
+
+// tokensCollection returns the MongoDB collection handle for issued tokens.
+func tokensCollection() *mongo.Collection {
+	dbName := config.Configuration.Database
+	return config.DBClients.MongoClient.Database(dbName).Collection("tokens")
+}
+
+// revocationEntry is a cached IsJTIRevoked answer for one JTI.
+type revocationEntry struct {
+	userID  string
+	revoked bool
+	until   time.Time // revoked: the token's expiry; otherwise when to re-check
+}
+
+// revocationCache sits in front of the tokens collection so authenticating a
+// request does not cost a database round trip every time.
+type revocationCache struct {
+	mu      sync.Mutex
+	entries map[string]revocationEntry
+}
+
+var revocations = &revocationCache{entries: make(map[string]revocationEntry)}
+
+func (c *revocationCache) get(jti string) (revocationEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[jti]
+	if ok && time.Now().After(e.until) {
+		delete(c.entries, jti)
+		return e, false
+	}
+	return e, ok
+}
+
+func (c *revocationCache) put(jti string, e revocationEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= revocationCacheSize {
+		now := time.Now()
+		for k, old := range c.entries {
+			if now.After(old.until) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= revocationCacheSize {
+		return
+	}
+	c.entries[jti] = e
+}
+
+// forgetUser drops cached answers for userID's tokens so they are re-checked.
+func (c *revocationCache) forgetUser(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if e.userID == userID {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// RecordJTI stores a newly issued token so it can later be revoked.
+func RecordJTI(ctx context.Context, jti, userID string, issued, exp time.Time) error {
+	_, err := tokensCollection().InsertOne(ctx, TokenDoc{
+		JTI:       jti,
+		UserID:    userID,
+		IssuedAt:  issued,
+		ExpiresAt: exp,
+	})
+	return err
+}
+
+// RevokeJTI marks a JWT ID as revoked until its expiration time.
+func RevokeJTI(ctx context.Context, jti, userID string, exp time.Time) error {
+	_, err := tokensCollection().UpdateOne(ctx,
+		bson.M{"jti": jti},
+		bson.M{
+			"$set":         bson.M{"revokedAt": time.Now()},
+			"$setOnInsert": bson.M{"userId": userID, "expiresAt": exp},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+	revocations.put(jti, revocationEntry{userID: userID, revoked: true, until: exp})
+	hub.GlobalHub.Revoke(userID, jti)
+	return nil
+}
+
+// RevokeUserTokens revokes every outstanding token issued to userID and closes
+// their WebSocket connections on every instance, logging them out everywhere.
+// It returns how many tokens were revoked.
+func RevokeUserTokens(ctx context.Context, userID string) (int64, error) {
+	res, err := tokensCollection().UpdateMany(ctx,
+		bson.M{
+			"userId":    userID,
+			"revokedAt": bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	revocations.forgetUser(userID)
+	hub.GlobalHub.Revoke(userID, "")
+	return res.ModifiedCount, nil
+}
+
+// ForgetRevocations drops cached token checks after another instance revoked
+// jti, or every token of userID when jti is empty, so the next check reads
+// the tokens collection.
+func ForgetRevocations(userID, jti string) {
+	if jti == "" {
+		revocations.forgetUser(userID)
+		return
+	}
+	revocations.mu.Lock()
+	delete(revocations.entries, jti)
+	revocations.mu.Unlock()
+}
+
+// IsJTIRevoked reports true if the JTI has been revoked.
+func IsJTIRevoked(ctx context.Context, jti string) (bool, error) {
+	if e, ok := revocations.get(jti); ok {
+		return e.revoked, nil
+	}
+
+	var doc TokenDoc
+	err := tokensCollection().FindOne(ctx, bson.M{"jti": jti}).Decode(&doc)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return false, err
+	}
+	if doc.RevokedAt != nil && time.Now().Before(doc.ExpiresAt) {
+		revocations.put(jti, revocationEntry{userID: doc.UserID, revoked: true, until: doc.ExpiresAt})
+		return true, nil
+	}
+	revocations.put(jti, revocationEntry{userID: doc.UserID, until: time.Now().Add(revocationCacheTTL)})
+	return false, nil
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+)
+
+// RoomIDPrefix marks conversation IDs that refer to a group room rather than a user.
+const RoomIDPrefix = "room:"
+
+var (
+	// ErrRoomNotFound is returned when no room matches the given ID.
+	ErrRoomNotFound = errors.New("room not found")
+	// ErrNotRoomMember is returned when a user acts on a room they do not belong to.
+	ErrNotRoomMember = errors.New("not a member of this room")
+	// ErrRoomNameRequired is returned when creating a room without a name.
+	ErrRoomNameRequired = errors.New("room name is required")
+)
+
+// RoomMember tracks a single user's membership in a room.
+type RoomMember struct {
+	UserID     string    `bson:"userId"`
+	JoinedAt   time.Time `bson:"joinedAt"`
+	NotifiedAt time.Time `bson:"notifiedAt"`
+}
+
+// RoomDoc represents a named group conversation stored in MongoDB.
+type RoomDoc struct {
+	RoomID    string       `bson:"roomId"`
+	Name      string       `bson:"name"`
+	CreatedBy string       `bson:"createdBy"`
+	Members   []RoomMember `bson:"members"`
+	CreatedAt time.Time    `bson:"createdAt"`
+}
+
+// MemberIDs returns the user IDs of every member of the room.
+func (r *RoomDoc) MemberIDs() []string {
+	ids := make([]string, 0, len(r.Members))
+	for _, m := range r.Members {
+		ids = append(ids, m.UserID)
+	}
+	return ids
+}
+
+// HasMember reports whether userID belongs to the room.
+func (r *RoomDoc) HasMember(userID string) bool {
+	for _, m := range r.Members {
+		if m.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRoomID reports whether a conversation ID addresses a room.
+func IsRoomID(id string) bool {
+	return strings.HasPrefix(id, RoomIDPrefix)
+}
+
+// roomsCollection returns the MongoDB collection handle for rooms.
+func roomsCollection() *mongo.Collection {
+	dbName := config.Configuration.Database
+	return config.DBClients.MongoClient.Database(dbName).Collection("rooms")
+}
+
+// CreateRoom creates a room owned by createdBy with the given initial members.
+func CreateRoom(ctx context.Context, name, createdBy string, members []string) (*RoomDoc, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrRoomNameRequired
+	}
+
+	members, err := existingMembers(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	room := RoomDoc{
+		RoomID:    RoomIDPrefix + ulid.Make().String(),
+		Name:      name,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+
+	seen := map[string]bool{}
+	for _, id := range append([]string{createdBy}, members...) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		room.Members = append(room.Members, RoomMember{UserID: id, JoinedAt: now, NotifiedAt: now})
+	}
+
+	if _, err := roomsCollection().InsertOne(ctx, room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// FindRoom looks up a room by its ID.
+func FindRoom(ctx context.Context, roomID string) (*RoomDoc, error) {
+	var room RoomDoc
+	err := roomsCollection().FindOne(ctx, bson.M{"roomId": roomID}).Decode(&room)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrRoomNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// FindRoomForMember looks up a room and verifies that userID belongs to it.
+func FindRoomForMember(ctx context.Context, roomID, userID string) (*RoomDoc, error) {
+	room, err := FindRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !room.HasMember(userID) {
+		return nil, ErrNotRoomMember
+	}
+	return room, nil
+}
+
+// AddRoomMembers adds users to a room, skipping anyone already in it.
+func AddRoomMembers(ctx context.Context, roomID string, userIDs []string) error {
+	userIDs, err := existingMembers(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, id := range userIDs {
+		_, err := roomsCollection().UpdateOne(ctx,
+			bson.M{"roomId": roomID, "members.userId": bson.M{"$ne": id}},
+			bson.M{"$push": bson.M{"members": RoomMember{UserID: id, JoinedAt: now, NotifiedAt: now}}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// existingMembers trims and dedupes userIDs and checks that each one is a
+// registered user, so rooms never list IDs nobody can log in as.
+func existingMembers(ctx context.Context, userIDs []string) ([]string, error) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range userIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if IsReservedUsername(id) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := usersCollection().Find(ctx, bson.M{"username": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"username": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var users []UserDoc
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(users))
+	for _, u := range users {
+		found[u.Username] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+		}
+	}
+	return ids, nil
+}
+
+// RemoveRoomMember removes a user from a room.
+func RemoveRoomMember(ctx context.Context, roomID, userID string) error {
+	_, err := roomsCollection().UpdateOne(ctx,
+		bson.M{"roomId": roomID},
+		bson.M{"$pull": bson.M{"members": bson.M{"userId": userID}}},
+	)
+	return err
+}
+
+// LoadUserRooms returns every room the user is a member of.
+func LoadUserRooms(ctx context.Context, userID string) ([]RoomDoc, error) {
+	cursor, err := roomsCollection().Find(ctx, bson.M{"members.userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rooms []RoomDoc
+	if err := cursor.All(ctx, &rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
@@ -1,39 +1,33 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"strings"
-	"time"
 
 	"github.com/zelshahawy/Anonymous_backend/config"
 	"github.com/zelshahawy/Anonymous_backend/internal/hub"
 )
 
-// friendlyError turns raw Go/HTTP errors into short, human-readable messages.
+// friendlyError turns finance client errors into short, human-readable messages.
 func friendlyError(context string, err error) string {
-	msg := err.Error()
 	switch {
-	case strings.Contains(msg, "no such host"),
-		strings.Contains(msg, "connection refused"),
-		strings.Contains(msg, "dial tcp"):
+	case errors.Is(err, ErrFinanceCircuitOpen):
+		return "The market data service is down right now. Check back in a minute!"
+	case errors.Is(err, ErrFinanceUnavailable):
 		return "Couldn't reach the market data service right now. Try again in a bit!"
-	case strings.Contains(msg, "timeout"),
-		strings.Contains(msg, "deadline exceeded"):
+	case errors.Is(err, ErrFinanceTimeout):
 		return "The request timed out. The market data service might be slow — give it another shot!"
-	case strings.Contains(msg, "service returned 404"):
+	case errors.Is(err, ErrFinanceNotFound):
 		return fmt.Sprintf("Couldn't find data for **%s**. Double-check the symbol and try again.", context)
-	case strings.Contains(msg, "service returned 5"),
-		strings.Contains(msg, "service returned 502"),
-		strings.Contains(msg, "service returned 503"):
+	case errors.Is(err, ErrFinanceUpstream):
 		return "The market data service is having issues. Hang tight and try again shortly!"
-	case strings.Contains(msg, "service returned 429"):
+	case errors.Is(err, ErrFinanceRateLimited):
 		return "Too many requests — slow down a bit and try again in a few seconds."
-	case strings.Contains(msg, "unmarshal"),
-		strings.Contains(msg, "decode"):
+	case errors.Is(err, ErrFinanceBadResponse):
 		return "Got an unexpected response from the market data service. Try again later."
 	default:
 		return fmt.Sprintf("Something went wrong fetching %s. Try again in a moment!", context)
@@ -48,86 +42,111 @@ type StockResponse struct {
 	EMA20  float64 `json:"ema20"`
 }
 
-var stockAPI = config.Config().GetString("stock_api")
+// financeAPI is the client for the Python finance service, see financeclient.go
+var financeAPI = NewFinanceClient(config.Config().GetString("stock_api"))
 
-// parseStockCommand returns the ticker symbol if text starts with /stocks
-func parseStockCommand(text string) (symbol string, ok bool) {
-	parts := strings.Fields(text)
-	if len(parts) == 2 && parts[0] == "/stocks" {
-		return strings.ToUpper(parts[1]), true
-	}
-	return "", false
+// financeResponses caches finance API responses, see financecache.go
+var financeResponses = newFinanceCache(financeAPI.Get)
+
+// FinanceAPIHealth reports whether the finance service circuit breaker is open.
+func FinanceAPIHealth() FinanceHealth {
+	return financeAPI.Health()
 }
 
-func stockMovers(text string) (ok bool) {
-	parts := strings.Fields(text)
-	if len(parts) == 1 && parts[0] == "/top-movers" {
-		return true
-	}
-	return false
+func init() {
+	RegisterCommand(Command{
+		Name:        "stocks",
+		Aliases:     []string{"stock", "quote"},
+		Args:        []CommandArg{{Name: "SYMBOL", Required: true}},
+		Description: "Get stock price and data",
+		Example:     "/stocks AAPL",
+		Handler:     HandleStockCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "top-movers",
+		Aliases:     []string{"movers"},
+		Description: "View today's biggest gainers and losers",
+		Handler:     HandleTopMoversCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "news",
+		Args:        []CommandArg{{Name: "SYMBOL"}},
+		Description: "View the latest market news, or news for one symbol",
+		Example:     "/news TSLA",
+		Handler:     HandleNewsCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "crypto",
+		Description: "View cryptocurrency prices",
+		Handler:     HandleCryptoCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "indices",
+		Description: "View major market indices (S&P 500, Dow, Nasdaq)",
+		Handler:     HandleIndicesCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "trending",
+		Description: "View most active stocks",
+		Handler:     HandleTrendingCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "chart",
+		Args:        []CommandArg{{Name: "SYMBOL", Required: true}, {Name: "PERIOD"}},
+		Description: "View price chart (" + strings.Join(chartPeriods, ", ") + ")",
+		Example:     "/chart AAPL 6mo",
+		Handler:     HandleChartCommand,
+	})
 }
 
 // fetchStock hits your FastAPI service and decodes the JSON
-func fetchStock(symbol string) (*StockResponse, error) {
-	client := http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(stockAPI + "/api/stocks/" + symbol)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("service returned %d", resp.StatusCode)
-	}
+func fetchStock(ctx context.Context, symbol string) (*StockResponse, error) {
 	var out StockResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+	if err := financeGetJSON(ctx, stockPath(symbol), &out); err != nil {
 		return nil, err
 	}
 	return &out, nil
 }
 
-func fetchTopMovers() ([]StockResponse, error) {
-	client := http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(stockAPI + "/api/top-movers/")
+// fetchLiveStock quotes symbol for a fill or an alert. Unlike fetchStock it
+// never falls back to a cached price that is past its freshness.
+func fetchLiveStock(ctx context.Context, symbol string) (*StockResponse, error) {
+	path := stockPath(symbol)
+	body, err := financeResponses.GetFresh(ctx, path, financeTTL(path))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("service returned %d", resp.StatusCode)
+	var out StockResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, &FinanceError{URL: path, Kind: ErrFinanceBadResponse, Err: err}
 	}
+	return &out, nil
+}
+
+func fetchTopMovers(ctx context.Context) ([]StockResponse, error) {
 	var out []StockResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+	if err := financeGetJSON(ctx, "/api/top-movers/", &out); err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-// httpGetJSON performs a GET and decodes JSON into out
-func httpGetJSON(url string, out interface{}) error {
-	client := http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(url)
+// financeGetJSON performs a cached GET of a finance API path and decodes JSON into out
+func financeGetJSON(ctx context.Context, path string, out interface{}) error {
+	bodyBytes, err := financeResponses.Get(ctx, path, financeTTL(path))
 	if err != nil {
-		log.Printf("httpGetJSON GET error: %v url=%s", err, url)
 		return err
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("httpGetJSON non-OK response: status=%d url=%s body=%s", resp.StatusCode, url, string(bodyBytes))
-		return fmt.Errorf("service returned %d: %s", resp.StatusCode, string(bodyBytes))
-	}
 
 	if err := json.Unmarshal(bodyBytes, out); err != nil {
-		log.Printf("httpGetJSON decode error: %v url=%s body=%s", err, url, string(bodyBytes))
-		return err
+		log.Printf("financeGetJSON decode error: %v path=%s body=%s", err, path, string(bodyBytes))
+		return &FinanceError{URL: path, Kind: ErrFinanceBadResponse, Err: err}
 	}
 	return nil
 }
 
-// formatStockLines formats an array of simple stock maps into lines
+// formatStockLines formats an array of simple stock maps into lines.
+// Stocks with an "ema20" entry also show their 20-day EMA.
 func formatStockLines(title string, stocks []map[string]any, limit int) string {
 	lines := []string{title, ""}
 	for i, s := range stocks {
@@ -141,11 +160,65 @@ func formatStockLines(title string, stocks []map[string]any, limit int) string {
 		if change > 0 {
 			emoji = "🟢"
 		}
-		lines = append(lines, fmt.Sprintf("%s **%s** $%.2f (%+.1f%%)", emoji, sym, price, change))
+		line := fmt.Sprintf("%s **%s** $%.2f (%+.1f%%)", emoji, sym, price, change)
+		if ema, ok := s["ema20"].(float64); ok {
+			line += fmt.Sprintf("  EMA20 $%.2f", ema)
+		}
+		lines = append(lines, line)
 	}
 	return strings.Join(lines, "\n")
 }
 
+// stockTable builds the table payload matching formatStockLines
+func stockTable(title string, stocks []map[string]any, limit int) TablePayload {
+	table := TablePayload{Title: title, Columns: []string{"Symbol", "Price", "Change"}}
+	withEMA := len(stocks) > 0 && stocks[0]["ema20"] != nil
+	if withEMA {
+		table.Columns = append(table.Columns, "EMA20")
+	}
+	for i, s := range stocks {
+		if i >= limit {
+			break
+		}
+		sym, _ := s["symbol"].(string)
+		price, _ := s["price"].(float64)
+		change, _ := s["change"].(float64)
+		row := []string{sym, fmt.Sprintf("%.2f", price), fmt.Sprintf("%+.2f%%", change)}
+		if withEMA {
+			ema, _ := s["ema20"].(float64)
+			row = append(row, fmt.Sprintf("%.2f", ema))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// newsItems picks the headline fields out of raw news entries
+func newsItems(news []map[string]any, limit int) []NewsItem {
+	items := []NewsItem{}
+	for i, a := range news {
+		if i >= limit {
+			break
+		}
+		var item NewsItem
+		item.Title, _ = a["title"].(string)
+		item.Source, _ = a["source"].(string)
+		item.URL, _ = a["url"].(string)
+		items = append(items, item)
+	}
+	return items
+}
+
+// chartSummary is the text body sent alongside a chart payload
+func chartSummary(c *ChartPayload) string {
+	text := fmt.Sprintf("📈 **%s** chart (%s)", c.Symbol, c.Period)
+	if n := len(c.Points); n > 1 && c.Points[0].Close != 0 {
+		first, last := c.Points[0].Close, c.Points[n-1].Close
+		text += fmt.Sprintf(": $%.2f → $%.2f (%+.1f%%)", first, last, (last-first)/first*100)
+	}
+	return text
+}
+
 // formatNewsLines formats news items into a compact list
 func formatNewsLines(sym string, news []map[string]any, limit int) string {
 	lines := []string{}
@@ -168,160 +241,129 @@ func formatNewsLines(sym string, news []map[string]any, limit int) string {
 	return strings.Join(lines, "\n")
 }
 
+// BotSender is the From of messages the bot sends on its own, such as alerts.
+const BotSender = "bot"
+
 type BotResponse struct {
 	From string
 	Body string
+	// Payload is the machine-readable form of Body, if the command has one.
+	Payload *hub.Payload
 }
 
 // HandleStockCommand returns zero or one "bot" message in response to a stock command
-func HandleStockCommand(in *hub.Message) []BotResponse {
-	sym, ok := parseStockCommand(in.Body)
-	if !ok {
-		return nil
+func HandleStockCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	sym, err := ParseSymbol(args[0])
+	if err != nil {
+		return invalidSymbolReply(args[0])
 	}
 
-	data, err := fetchStock(sym)
-	var text string
+	data, err := fetchStock(ctx, sym)
 	if err != nil {
-		text = friendlyError(sym, err)
-	} else {
-		text = fmt.Sprintf("📈 %s  Price: $%.2f  Change: %.2f%%  EMA20: $%.2f",
-			data.Symbol, data.Price, data.Change, data.EMA20)
+		return []BotResponse{{From: "bot", Body: friendlyError(sym, err)}}
 	}
 
-	return []BotResponse{{
-		From: "bot",
-		Body: text,
-	}}
+	text := fmt.Sprintf("📈 %s  Price: $%.2f  Change: %.2f%%  EMA20: $%.2f",
+		data.Symbol, data.Price, data.Change, data.EMA20)
+	return botReply(text, hub.PayloadQuote, QuotePayload(*data))
 }
 
-func HandleTopMoversCommand(in *hub.Message) []BotResponse {
-	ok := stockMovers(in.Body)
-	if !ok {
-		return nil
+// HandleTopMoversCommand returns the day's biggest gainers and losers
+func HandleTopMoversCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	data, err := fetchTopMovers(ctx)
+	if err != nil {
+		return []BotResponse{{From: "bot", Body: friendlyError("top movers", err)}}
 	}
 
-	data, err := fetchTopMovers()
-	var text string
-	if err != nil {
-		text = friendlyError("top movers", err)
-	} else {
-		var lines []string
-		lines = append(lines, "📊 **Top Movers Today**")
-		lines = append(lines, "")
-
-		// Separate gainers and losers
-		var gainers []StockResponse
-		var losers []StockResponse
-
-		for _, stock := range data {
-			if stock.Change > 0 {
-				gainers = append(gainers, stock)
-			} else {
-				losers = append(losers, stock)
-			}
-		}
+	var lines []string
+	lines = append(lines, "📊 **Top Movers Today**")
+	lines = append(lines, "")
+	table := TablePayload{Title: "Top Movers Today", Columns: []string{"Symbol", "Price", "Change"}}
 
-		// Add top 3 gainers
-		lines = append(lines, "🟢 **Top Gainers:**")
-		maxGainers := 5
-		if len(gainers) > maxGainers {
-			gainers = gainers[:maxGainers]
-		}
-		for _, stock := range gainers {
-			line := fmt.Sprintf("**%s** $%.2f (+%.1f%%)",
-				stock.Symbol, stock.Price, stock.Change)
-			lines = append(lines, line)
+	// Separate gainers and losers
+	var gainers []StockResponse
+	var losers []StockResponse
+
+	for _, stock := range data {
+		if stock.Change > 0 {
+			gainers = append(gainers, stock)
+		} else {
+			losers = append(losers, stock)
 		}
+	}
 
-		lines = append(lines, "")
+	// Add top 5 gainers
+	lines = append(lines, "🟢 **Top Gainers:**")
+	maxGainers := 5
+	if len(gainers) > maxGainers {
+		gainers = gainers[:maxGainers]
+	}
+	for _, stock := range gainers {
+		line := fmt.Sprintf("**%s** $%.2f (+%.1f%%)",
+			stock.Symbol, stock.Price, stock.Change)
+		lines = append(lines, line)
+		table.Rows = append(table.Rows, moverRow(stock))
+	}
 
-		// Add top 3 losers
-		lines = append(lines, "🔴 **Top Losers:**")
-		maxLosers := 5
-		if len(losers) > maxLosers {
-			losers = losers[:maxLosers]
-		}
-		for _, stock := range losers {
-			line := fmt.Sprintf("**%s** $%.2f (%.1f%%)",
-				stock.Symbol, stock.Price, stock.Change)
-			lines = append(lines, line)
-		}
+	lines = append(lines, "")
 
-		text = strings.Join(lines, "\n")
+	// Add top 5 losers
+	lines = append(lines, "🔴 **Top Losers:**")
+	maxLosers := 5
+	if len(losers) > maxLosers {
+		losers = losers[:maxLosers]
+	}
+	for _, stock := range losers {
+		line := fmt.Sprintf("**%s** $%.2f (%.1f%%)",
+			stock.Symbol, stock.Price, stock.Change)
+		lines = append(lines, line)
+		table.Rows = append(table.Rows, moverRow(stock))
 	}
 
-	return []BotResponse{{
-		From: "bot",
-		Body: text,
-	}}
+	return botReply(strings.Join(lines, "\n"), hub.PayloadTable, table)
 }
 
-// parseNewsCommand returns the symbol if text starts with /news
-func parseNewsCommand(text string) (symbol string, ok bool) {
-	parts := strings.Fields(text)
-	if len(parts) >= 1 && parts[0] == "/news" {
-		if len(parts) == 2 {
-			return strings.ToUpper(parts[1]), true
-		}
-		return "", true
-	}
-	return "", false
+// moverRow renders one stock as a Symbol/Price/Change table row
+func moverRow(s StockResponse) []string {
+	return []string{s.Symbol, fmt.Sprintf("%.2f", s.Price), fmt.Sprintf("%+.2f%%", s.Change)}
 }
 
 // HandleNewsCommand returns bot messages for news commands
-func HandleNewsCommand(in *hub.Message) []BotResponse {
-	sym, ok := parseNewsCommand(in.Body)
-	if !ok {
-		return nil
+func HandleNewsCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	var sym string
+	limit := 5
+	if len(args) > 0 {
+		var err error
+		if sym, err = ParseSymbol(args[0]); err != nil {
+			return invalidSymbolReply(args[0])
+		}
+		limit = 3
 	}
 
 	var newsData []map[string]interface{}
-	url := stockAPI + "/api/news?limit=5"
-	if sym != "" {
-		url = stockAPI + "/api/news?symbol=" + sym + "&limit=3"
-	}
-	if err := httpGetJSON(url, &newsData); err != nil {
+	if err := financeGetJSON(ctx, newsPath(sym, limit), &newsData); err != nil {
 		return []BotResponse{{From: "bot", Body: friendlyError("news", err)}}
 	}
 
-	return []BotResponse{{From: "bot", Body: formatNewsLines(sym, newsData, 3)}}
-}
-
-// parseCryptoCommand checks for /crypto
-func parseCryptoCommand(text string) bool {
-	parts := strings.Fields(text)
-	return len(parts) == 1 && parts[0] == "/crypto"
+	return botReply(formatNewsLines(sym, newsData, 3), hub.PayloadNews,
+		NewsPayload{Symbol: sym, Items: newsItems(newsData, 3)})
 }
 
 // HandleCryptoCommand returns crypto prices
-func HandleCryptoCommand(in *hub.Message) []BotResponse {
-	if !parseCryptoCommand(in.Body) {
-		return nil
-	}
-
+func HandleCryptoCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
 	var cryptoData []map[string]interface{}
-	if err := httpGetJSON(stockAPI+"/api/crypto", &cryptoData); err != nil {
+	if err := financeGetJSON(ctx, "/api/crypto", &cryptoData); err != nil {
 		return []BotResponse{{From: "bot", Body: friendlyError("crypto", err)}}
 	}
 
-	return []BotResponse{{From: "bot", Body: formatStockLines("₿ **Crypto Prices:**", cryptoData, len(cryptoData))}}
-}
-
-// parseIndicesCommand checks for /indices
-func parseIndicesCommand(text string) bool {
-	parts := strings.Fields(text)
-	return len(parts) == 1 && parts[0] == "/indices"
+	return botReply(formatStockLines("₿ **Crypto Prices:**", cryptoData, len(cryptoData)), hub.PayloadTable,
+		stockTable("Crypto Prices", cryptoData, len(cryptoData)))
 }
 
 // HandleIndicesCommand returns market indices
-func HandleIndicesCommand(in *hub.Message) []BotResponse {
-	if !parseIndicesCommand(in.Body) {
-		return nil
-	}
-
+func HandleIndicesCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
 	var idx map[string]map[string]any
-	if err := httpGetJSON(stockAPI+"/api/indices", &idx); err != nil {
+	if err := financeGetJSON(ctx, "/api/indices", &idx); err != nil {
 		return []BotResponse{{From: "bot", Body: friendlyError("indices", err)}}
 	}
 
@@ -331,58 +373,44 @@ func HandleIndicesCommand(in *hub.Message) []BotResponse {
 		vals = append(vals, v)
 	}
 
-	return []BotResponse{{From: "bot", Body: formatStockLines("📊 **Market Indices:**", vals, len(vals))}}
+	return botReply(formatStockLines("📊 **Market Indices:**", vals, len(vals)), hub.PayloadTable,
+		stockTable("Market Indices", vals, len(vals)))
 }
 
-// parseChartCommand parses /chart SYMBOL or /chart SYMBOL PERIOD
-func parseChartCommand(text string) (symbol string, period string, ok bool) {
-	parts := strings.Fields(text)
-	if len(parts) < 2 || parts[0] != "/chart" {
-		return "", "", false
-	}
-	symbol = strings.ToUpper(parts[1])
-	period = "1mo"
-	if len(parts) >= 3 {
-		period = strings.ToLower(parts[2])
+// HandleChartCommand fetches historical data and returns it as a chart payload
+func HandleChartCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	sym, err := ParseSymbol(args[0])
+	if err != nil {
+		return invalidSymbolReply(args[0])
 	}
-	return symbol, period, true
-}
-
-// HandleChartCommand fetches historical data and returns it as CHART_DATA: JSON
-func HandleChartCommand(in *hub.Message) []BotResponse {
-	sym, period, ok := parseChartCommand(in.Body)
-	if !ok {
-		return nil
+	period := defaultChartPeriod
+	if len(args) > 1 {
+		if period, err = ParsePeriod(args[1]); err != nil {
+			return invalidPeriodReply(args[1])
+		}
 	}
 
-	url := fmt.Sprintf("%s/api/chart/%s?period=%s", stockAPI, sym, period)
-	var chartData json.RawMessage
-	if err := httpGetJSON(url, &chartData); err != nil {
+	var chart ChartPayload
+	if err := financeGetJSON(ctx, chartPath(sym, period), &chart); err != nil {
 		return []BotResponse{{From: "bot", Body: friendlyError(sym, err)}}
 	}
+	if chart.Symbol == "" {
+		chart.Symbol = sym
+	}
+	if chart.Period == "" {
+		chart.Period = period
+	}
 
-	return []BotResponse{{
-		From: "bot",
-		Body: "CHART_DATA:" + string(chartData),
-	}}
-}
-
-// parseTrendingCommand checks for /trending
-func parseTrendingCommand(text string) bool {
-	parts := strings.Fields(text)
-	return len(parts) == 1 && parts[0] == "/trending"
+	return botReply(chartSummary(&chart), hub.PayloadChart, chart)
 }
 
 // HandleTrendingCommand returns trending stocks
-func HandleTrendingCommand(in *hub.Message) []BotResponse {
-	if !parseTrendingCommand(in.Body) {
-		return nil
-	}
-
+func HandleTrendingCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
 	var trending []map[string]any
-	if err := httpGetJSON(stockAPI+"/api/trending", &trending); err != nil {
+	if err := financeGetJSON(ctx, "/api/trending", &trending); err != nil {
 		return []BotResponse{{From: "bot", Body: friendlyError("trending", err)}}
 	}
 
-	return []BotResponse{{From: "bot", Body: formatStockLines("🔥 **Trending Stocks:**", trending, 5)}}
+	return botReply(formatStockLines("🔥 **Trending Stocks:**", trending, 5), hub.PayloadTable,
+		stockTable("Trending Stocks", trending, 5))
 }
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultChartPeriod is the history /chart shows when none is given.
+const defaultChartPeriod = "1mo"
+
+var (
+	// ErrInvalidSymbol is returned for text that cannot be a ticker symbol.
+	ErrInvalidSymbol = errors.New("invalid ticker symbol")
+	// ErrInvalidPeriod is returned for a chart period the finance API does not accept.
+	ErrInvalidPeriod = errors.New("invalid chart period")
+)
+
+// symbolPattern accepts tickers such as AAPL, BRK.B, BTC-USD, ^GSPC and EURUSD=X.
+var symbolPattern = regexp.MustCompile(`^\^?[A-Z0-9][A-Z0-9.\-=]{0,14}$`)
+
+// chartPeriods are the periods the finance API's chart endpoint accepts.
+var chartPeriods = []string{"1d", "5d", "1mo", "3mo", "6mo", "1y", "2y", "5y", "max"}
+
+// ParseSymbol normalizes a ticker symbol to upper case and validates it.
+func ParseSymbol(s string) (string, error) {
+	sym := strings.ToUpper(strings.TrimPrefix(s, "$"))
+	if !symbolPattern.MatchString(sym) {
+		return "", ErrInvalidSymbol
+	}
+	return sym, nil
+}
+
+// ParseSymbols validates every symbol, returning the first invalid input on error.
+func ParseSymbols(args []string) ([]string, string, error) {
+	out := make([]string, 0, len(args))
+	for _, a := range args {
+		sym, err := ParseSymbol(a)
+		if err != nil {
+			return nil, a, err
+		}
+		out = append(out, sym)
+	}
+	return out, "", nil
+}
+
+// ParsePeriod normalizes a chart period to lower case and validates it.
+func ParsePeriod(s string) (string, error) {
+	period := strings.ToLower(s)
+	for _, p := range chartPeriods {
+		if p == period {
+			return period, nil
+		}
+	}
+	return "", ErrInvalidPeriod
+}
+
+// invalidSymbolReply explains why arg was rejected as a symbol.
+func invalidSymbolReply(arg string) []BotResponse {
+	return []BotResponse{{From: "bot", Body: fmt.Sprintf(
+		"`%s` isn't a valid ticker. Symbols look like `AAPL`, `BRK.B` or `BTC-USD`.", arg)}}
+}
+
+// invalidPeriodReply explains why arg was rejected as a chart period.
+func invalidPeriodReply(arg string) []BotResponse {
+	return []BotResponse{{From: "bot", Body: fmt.Sprintf(
+		"`%s` isn't a valid period. Use one of: %s.", arg, strings.Join(chartPeriods, ", "))}}
+}
+
+// stockPath is the finance API path for a quote.
+func stockPath(symbol string) string {
+	return "/api/stocks/" + url.PathEscape(symbol)
+}
+
+// chartPath is the finance API path for a symbol's price history.
+func chartPath(symbol, period string) string {
+	return "/api/chart/" + url.PathEscape(symbol) + "?" + url.Values{"period": {period}}.Encode()
+}
+
+// newsPath is the finance API path for market news, or one symbol's news.
+func newsPath(symbol string, limit int) string {
+	q := url.Values{"limit": {fmt.Sprint(limit)}}
+	if symbol != "" {
+		q.Set("symbol", symbol)
+	}
+	return "/api/news?" + q.Encode()
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSymbol(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr error
+	}{
+		{in: "AAPL", want: "AAPL"},
+		{in: "aapl", want: "AAPL"},
+		{in: "$msft", want: "MSFT"},
+		{in: "BRK.B", want: "BRK.B"},
+		{in: "^GSPC", want: "^GSPC"},
+		{in: "^gspc", want: "^GSPC"},
+		{in: "BTC-USD", want: "BTC-USD"},
+		{in: "btc-usd", want: "BTC-USD"},
+		{in: "EURUSD=X", want: "EURUSD=X"},
+		{in: "A" + strings.Repeat("B", 14), want: "A" + strings.Repeat("B", 14)},
+		{in: "", wantErr: ErrInvalidSymbol},
+		{in: "$", wantErr: ErrInvalidSymbol},
+		{in: "A" + strings.Repeat("B", 15), wantErr: ErrInvalidSymbol},
+		{in: "../", wantErr: ErrInvalidSymbol},
+		{in: "..", wantErr: ErrInvalidSymbol},
+		{in: "AAPL/../admin", wantErr: ErrInvalidSymbol},
+		{in: "A/B", wantErr: ErrInvalidSymbol},
+		{in: "/AAPL", wantErr: ErrInvalidSymbol},
+		{in: "AAPL?period=max", wantErr: ErrInvalidSymbol},
+		{in: "AAPL#x", wantErr: ErrInvalidSymbol},
+		{in: "AA PL", wantErr: ErrInvalidSymbol},
+		{in: "AAPL%2F", wantErr: ErrInvalidSymbol},
+		{in: "-USD", wantErr: ErrInvalidSymbol},
+		{in: "^^GSPC", wantErr: ErrInvalidSymbol},
+		{in: "GS^PC", wantErr: ErrInvalidSymbol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSymbol(tt.in)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseSymbol(%q) = %q, %v; want %v", tt.in, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseSymbol(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSymbols(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []string
+		wantBad string
+	}{
+		{args: []string{"aapl", "^gspc", "BTC-USD"}, want: []string{"AAPL", "^GSPC", "BTC-USD"}},
+		{args: []string{"AAPL", "../x", "MSFT?"}, wantBad: "../x"},
+	}
+	for _, tt := range tests {
+		got, bad, err := ParseSymbols(tt.args)
+		if tt.wantBad != "" {
+			if bad != tt.wantBad || !errors.Is(err, ErrInvalidSymbol) {
+				t.Errorf("ParseSymbols(%q) = %q, %v; want %q rejected", tt.args, bad, err, tt.wantBad)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSymbols(%q) = %q, %v; want %q", tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr error
+	}{
+		{in: "1d", want: "1d"},
+		{in: "5d", want: "5d"},
+		{in: "1mo", want: "1mo"},
+		{in: "1MO", want: "1mo"},
+		{in: "1y", want: "1y"},
+		{in: "Max", want: "max"},
+		{in: "", wantErr: ErrInvalidPeriod},
+		{in: "2d", wantErr: ErrInvalidPeriod},
+		{in: "10y", wantErr: ErrInvalidPeriod},
+		{in: "1mo&interval=1m", wantErr: ErrInvalidPeriod},
+		{in: " 1mo", wantErr: ErrInvalidPeriod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePeriod(tt.in)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParsePeriod(%q) = %q, %v; want %v", tt.in, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParsePeriod(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinancePaths(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{stockPath("AAPL"), "/api/stocks/AAPL"},
+		{stockPath("^GSPC"), "/api/stocks/%5EGSPC"},
+		{stockPath("EURUSD=X"), "/api/stocks/EURUSD=X"},
+		{chartPath("BTC-USD", "1mo"), "/api/chart/BTC-USD?period=1mo"},
+		{chartPath("^GSPC", "max"), "/api/chart/%5EGSPC?period=max"},
+		// Escaping holds even for input that skipped ParseSymbol.
+		{chartPath("../admin?x=1", "1y"), "/api/chart/..%2Fadmin%3Fx=1?period=1y"},
+		{newsPath("", 5), "/api/news?limit=5"},
+		{newsPath("AAPL", 3), "/api/news?limit=3&symbol=AAPL"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q; want %q", tt.got, tt.want)
+		}
+	}
+}
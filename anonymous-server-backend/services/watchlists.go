@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/zelshahawy/Anonymous_backend/config"
+	"github.com/zelshahawy/Anonymous_backend/internal/hub"
+)
+
+const (
+	// maxWatchSymbols caps how many symbols one watchlist holds.
+	maxWatchSymbols = 25
+	// watchlistWorkers is how many quotes /watchlist fetches at once.
+	watchlistWorkers = 5
+)
+
+// ErrWatchlistFull is returned when adding symbols would exceed maxWatchSymbols.
+var ErrWatchlistFull = errors.New("watchlist is full")
+
+// WatchlistDoc is the list of symbols a user follows.
+type WatchlistDoc struct {
+	UserID    string    `bson:"userId"`
+	Symbols   []string  `bson:"symbols"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// watchlistsCollection returns the MongoDB collection handle for watchlists.
+func watchlistsCollection() *mongo.Collection {
+	dbName := config.Configuration.Database
+	return config.DBClients.MongoClient.Database(dbName).Collection("watchlists")
+}
+
+// LoadWatchlist returns the symbols userID follows, in the order they were added.
+func LoadWatchlist(ctx context.Context, userID string) ([]string, error) {
+	var doc WatchlistDoc
+	err := watchlistsCollection().FindOne(ctx, bson.M{"userId": userID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Symbols, nil
+}
+
+// AddToWatchlist adds symbols to userID's watchlist, skipping ones already on it.
+func AddToWatchlist(ctx context.Context, userID string, symbols []string) error {
+	current, err := LoadWatchlist(ctx, userID)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(current))
+	for _, s := range current {
+		seen[s] = true
+	}
+	added := 0
+	for _, s := range symbols {
+		if !seen[s] {
+			seen[s] = true
+			added++
+		}
+	}
+	if len(current)+added > maxWatchSymbols {
+		return ErrWatchlistFull
+	}
+
+	_, err = watchlistsCollection().UpdateOne(ctx,
+		bson.M{"userId": userID},
+		bson.M{
+			"$addToSet": bson.M{"symbols": bson.M{"$each": symbols}},
+			"$set":      bson.M{"updatedAt": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// RemoveFromWatchlist removes symbols from userID's watchlist.
+func RemoveFromWatchlist(ctx context.Context, userID string, symbols []string) error {
+	_, err := watchlistsCollection().UpdateOne(ctx,
+		bson.M{"userId": userID},
+		bson.M{
+			"$pull": bson.M{"symbols": bson.M{"$in": symbols}},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	return err
+}
+
+// fetchQuotes prices symbols concurrently. Quotes come back in the order of
+// symbols; a symbol that failed has a nil quote and its error in errs.
+func fetchQuotes(ctx context.Context, symbols []string) ([]*StockResponse, []error) {
+	quotes := make([]*StockResponse, len(symbols))
+	errs := make([]error, len(symbols))
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(watchlistWorkers, len(symbols)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				quotes[i], errs[i] = fetchStock(ctx, symbols[i])
+			}
+		}()
+	}
+	for i := range symbols {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return quotes, errs
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "watch",
+		Args: []CommandArg{
+			{Name: "add|rm|list", Required: true},
+			{Name: "SYMBOL", Variadic: true},
+		},
+		Description: "Manage your watchlist",
+		Example:     "/watch add AAPL MSFT",
+		Handler:     HandleWatchCommand,
+	})
+	RegisterCommand(Command{
+		Name:        "watchlist",
+		Description: "Quote every symbol on your watchlist",
+		Handler:     HandleWatchlistCommand,
+	})
+}
+
+// HandleWatchCommand adds, removes or lists watchlist symbols
+func HandleWatchCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	action := strings.ToLower(args[0])
+	symbols, bad, err := ParseSymbols(args[1:])
+	if err != nil {
+		return invalidSymbolReply(bad)
+	}
+
+	cmd, _ := Commands.Lookup("watch")
+	switch action {
+	case "list":
+		current, err := LoadWatchlist(ctx, in.From)
+		if err != nil {
+			log.Printf("failed to load watchlist for %s: %v", in.From, err)
+			return []BotResponse{{From: "bot", Body: "Couldn't load your watchlist. Try again in a moment!"}}
+		}
+		if len(current) == 0 {
+			return []BotResponse{{From: "bot", Body: "Your watchlist is empty. Try `/watch add AAPL MSFT`."}}
+		}
+		return []BotResponse{{From: "bot", Body: "👀 **Watching:** " + strings.Join(current, ", ")}}
+
+	case "add":
+		if len(symbols) == 0 {
+			return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+		}
+		switch err := AddToWatchlist(ctx, in.From, symbols); {
+		case errors.Is(err, ErrWatchlistFull):
+			return []BotResponse{{From: "bot", Body: fmt.Sprintf("A watchlist holds up to %d symbols. Remove some with `/watch rm SYMBOL` first.", maxWatchSymbols)}}
+		case err != nil:
+			log.Printf("failed to update watchlist for %s: %v", in.From, err)
+			return []BotResponse{{From: "bot", Body: "Couldn't update your watchlist. Try again in a moment!"}}
+		}
+		return []BotResponse{{From: "bot", Body: "👀 Added " + strings.Join(symbols, ", ") + " to your watchlist."}}
+
+	case "rm":
+		if len(symbols) == 0 {
+			return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+		}
+		if err := RemoveFromWatchlist(ctx, in.From, symbols); err != nil {
+			log.Printf("failed to update watchlist for %s: %v", in.From, err)
+			return []BotResponse{{From: "bot", Body: "Couldn't update your watchlist. Try again in a moment!"}}
+		}
+		return []BotResponse{{From: "bot", Body: "Removed " + strings.Join(symbols, ", ") + " from your watchlist."}}
+	}
+	return []BotResponse{{From: "bot", Body: usageReply(cmd)}}
+}
+
+// HandleWatchlistCommand quotes every watchlist symbol in one table
+func HandleWatchlistCommand(ctx context.Context, in *hub.Message, args []string) []BotResponse {
+	symbols, err := LoadWatchlist(ctx, in.From)
+	if err != nil {
+		log.Printf("failed to load watchlist for %s: %v", in.From, err)
+		return []BotResponse{{From: "bot", Body: "Couldn't load your watchlist. Try again in a moment!"}}
+	}
+	if len(symbols) == 0 {
+		return []BotResponse{{From: "bot", Body: "Your watchlist is empty. Try `/watch add AAPL MSFT`."}}
+	}
+
+	quotes, errs := fetchQuotes(ctx, symbols)
+	var rows []map[string]any
+	var failed []string
+	for i, q := range quotes {
+		if q == nil {
+			log.Printf("watchlist: failed to quote %s: %v", symbols[i], errs[i])
+			failed = append(failed, symbols[i])
+			continue
+		}
+		rows = append(rows, map[string]any{
+			"symbol": q.Symbol,
+			"price":  q.Price,
+			"change": q.Change,
+			"ema20":  q.EMA20,
+		})
+	}
+	if len(rows) == 0 {
+		return []BotResponse{{From: "bot", Body: friendlyError("your watchlist", errs[0])}}
+	}
+
+	text := formatStockLines("👀 **Your Watchlist:**", rows, len(rows))
+	if len(failed) > 0 {
+		text += "\n\n⚠️ Couldn't fetch " + strings.Join(failed, ", ")
+	}
+	return botReply(text, hub.PayloadTable, stockTable("Your Watchlist", rows, len(rows)))
+}